@@ -15,12 +15,23 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"html/template"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"catchpoint-prometheus-exporter/collector"
 
 	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -35,40 +46,426 @@ func main() {
 	var (
 		port        = kingpin.Flag("port", "The port to bind the HTTP server.").Default("9090").Envar("CATCHPOINT_EXPORTER_PORT").String()
 		webhookPath = kingpin.Flag("webhook-path", "The path to receive webhooks.").Default("/webhook").String()
+		alertPath   = kingpin.Flag("webhook.alert-path", "The path to receive alert webhooks.").Default("/webhook/alerts").String()
 		verbose     = kingpin.Flag("verbose", "Enable verbose logging").Default("false").Bool()
+		historySize = kingpin.Flag("history.size", "Number of recent results kept per test and node for the query API.").Default("10").Int()
+		staleAfter  = kingpin.Flag("web.stale-after", "Age after which a test and node are highlighted as stale on the status page.").Default("1h").Duration()
+		seriesTTL   = kingpin.Flag("series.ttl", "Drop series not updated within this duration. 0 keeps them forever.").Default("0s").Duration()
+
+		readHeaderTimeout = kingpin.Flag("web.read-header-timeout", "Maximum duration for reading request headers.").Default("10s").Duration()
+		readTimeout       = kingpin.Flag("web.read-timeout", "Maximum duration for reading an entire request.").Default("30s").Duration()
+		writeTimeout      = kingpin.Flag("web.write-timeout", "Maximum duration for writing a response. Does not apply to the event stream.").Default("30s").Duration()
+		idleTimeout       = kingpin.Flag("web.idle-timeout", "Maximum duration to keep idle keep-alive connections open.").Default("2m").Duration()
+		drainPeriod       = kingpin.Flag("web.drain-period", "Duration to report not ready and keep serving after SIGTERM, so load balancers stop sending webhooks.").Default("0s").Duration()
+		shutdownTimeout   = kingpin.Flag("web.shutdown-timeout", "Maximum duration to wait for in-flight requests on shutdown.").Default("30s").Duration()
+		enableLifecycle   = kingpin.Flag("web.enable-lifecycle", "Enable the /-/reload endpoint.").Default("false").Bool()
+
+		ingestWorkers   = kingpin.Flag("ingest.workers", "Number of workers processing decoded webhooks. 0 processes webhooks in the request handler.").Default("4").Int()
+		ingestQueueSize = kingpin.Flag("ingest.queue-size", "Number of decoded webhooks that can wait for a worker before webhooks are rejected with 429.").Default("1000").Int()
+
+		idempotencyTTL = kingpin.Flag("webhook.idempotency-ttl", "How long responses to webhooks with an Idempotency-Key header are remembered. 0 disables idempotency keys.").Default("24h").Duration()
+		maxBodySize    = kingpin.Flag("webhook.max-body-size", "Maximum size of a webhook body. Larger webhooks are rejected with 413.").Default("10MiB").Bytes()
+		maxDecodedSize = kingpin.Flag("webhook.max-decoded-size", "Maximum size of a compressed webhook body after decoding. Larger webhooks are rejected with 413.").Default("50MiB").Bytes()
+		rateLimit      = kingpin.Flag("webhook.rate-limit", "Maximum webhooks per second per source IP. Throttled webhooks are rejected with 429. 0 disables the limit.").Default("0").Float64()
+		rateBurst      = kingpin.Flag("webhook.rate-burst", "Number of webhooks a source IP can send at once before the rate limit applies.").Default("10").Int()
+
+		seriesLimit           = kingpin.Flag("series.limit", "Maximum number of series. 0 disables the limit.").Default("0").Int()
+		seriesLimitPerTest    = kingpin.Flag("series.limit-per-test", "Maximum number of series per test. 0 disables the limit.").Default("0").Int()
+		labelValueLengthLimit = kingpin.Flag("series.label-value-length-limit", "Truncate label values longer than this many bytes. 0 disables the limit.").Default("0").Int()
+		seriesLimitPolicy     = kingpin.Flag("series.limit-policy", "What to do with a new series at a series limit: reject it or evict the least recently updated series.").Default(collector.LimitPolicyReject).Enum(collector.LimitPolicyReject, collector.LimitPolicyEvict)
+		hostsLimit            = kingpin.Flag("hosts.limit", "Number of hosts of a result exported with a host label. The other hosts are merged into host=\"other\". 0 disables the limit.").Default("10").Int()
+		stepsLimit            = kingpin.Flag("steps.limit", "Number of steps of a result exported. The other steps are dropped. 0 disables the limit.").Default("50").Int()
+		hostsRankBy           = kingpin.Flag("hosts.rank-by", "What decides the hosts exported at the hosts limit: most requests, failed requests, content size or highest average wait time.").Default(collector.HostRankRequests).Enum(collector.HostRankRequests, collector.HostRankFailures, collector.HostRankSize, collector.HostRankWait)
+
+		persistenceFile     = kingpin.Flag("persistence.file", "File to persist the latest results to across restarts. Persistence is disabled when empty.").Default("").String()
+		persistenceInterval = kingpin.Flag("persistence.interval", "Interval between snapshots of the latest results.").Default("1m").Duration()
+
+		journalDir      = kingpin.Flag("journal.dir", "Directory to journal accepted webhook bodies to. Journaling is disabled when empty.").Default("").String()
+		journalMaxSize  = kingpin.Flag("journal.max-size", "Size after which a new journal segment is started.").Default("64MiB").Bytes()
+		journalMaxFiles = kingpin.Flag("journal.max-files", "Number of journal segments to retain. 0 retains all segments.").Default("10").Int()
+
+		replicationPeers      = kingpin.Flag("replication.peer", "Webhook URL of a peer exporter to forward accepted webhooks to. Can be repeated.").Strings()
+		replicationInstanceID = kingpin.Flag("replication.instance-id", "ID of this instance sent along with replicated webhooks. Defaults to the hostname.").Default("").String()
+		replicationSecret     = kingpin.Flag("replication.secret", "Secret shared by all peers that authenticates replicated webhooks. Required with --replication.peer.").Default("").Envar("CATCHPOINT_EXPORTER_REPLICATION_SECRET").String()
+
+		alertmanagerURLs           = kingpin.Flag("alertmanager.url", "URL of an Alertmanager to send the alerts of the alert webhook to. Can be repeated.").Strings()
+		alertmanagerResendInterval = kingpin.Flag("alertmanager.resend-interval", "Interval between resends of active alerts to Alertmanager. 0 disables resending.").Default("1m").Duration()
+		alertmanagerTestURL        = kingpin.Flag("alertmanager.test-url", "URL of a test in Catchpoint linked from alerts, with {test_id} replaced by the test ID. Alerts are not linked when empty.").Default("").String()
+
+		parseNodeNames = kingpin.Flag("node.parse-names", "Add node_city, node_country and node_isp labels parsed from node names like \"City, CC - Provider\".").Default("false").Bool()
+		dropNodeName   = kingpin.Flag("node.drop-name-label", "Remove the node_name label from result metrics, so renaming a node does not change its series. Join on catchpoint_node_info for node names.").Default("false").Bool()
+		nodeLookupFile = kingpin.Flag("node.lookup-file", "CSV or JSON file mapping NodeId values to latitude, longitude and region labels.").Default("").String()
+
+		configFile = kingpin.Flag("config.file", "Path to the configuration file defining tenants.").Default("").String()
+
+		serveCmd = kingpin.Command("serve", "Run the exporter.").Default()
+
+		replayCmd     = kingpin.Command("replay", "Replay a webhook journal through the ingestion path.")
+		replayJournal = replayCmd.Flag("journal", "Journal directory to replay.").Required().String()
+		replayURL     = replayCmd.Flag("url", "Webhook URL to post the journaled bodies to instead of ingesting them locally.").Default("").String()
+		replayTenant  = replayCmd.Flag("tenant", "Name of the tenant in the config file whose configuration the journal is replayed with.").Default("").String()
+		replaySecret  = replayCmd.Flag("webhook.secret", "Bearer token sent with the bodies posted to --url. Defaults to the secret of --tenant.").Default("").String()
 	)
 
-	kingpin.Version("1.0.0")
-	kingpin.Parse()
+	kingpin.Version(version)
+	command := kingpin.Parse()
 
 	logger := promlog.New(promlogConfig)
 	cfg := &collector.Config{
-		VerboseLogging: *verbose,
-		Port:           *port,
-		WebhookPath:    *webhookPath,
+		VerboseLogging:   *verbose,
+		Port:             *port,
+		WebhookPath:      *webhookPath,
+		AlertWebhookPath: *alertPath,
+		MetricsPath:      "/metrics",
+		HistorySize:      *historySize,
+		StaleAfter:       *staleAfter,
+		SeriesTTL:        *seriesTTL,
+
+		ReadHeaderTimeout: *readHeaderTimeout,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+		DrainPeriod:       *drainPeriod,
+		ShutdownTimeout:   *shutdownTimeout,
+
+		SeriesLimit:           *seriesLimit,
+		SeriesLimitPerTest:    *seriesLimitPerTest,
+		LabelValueLengthLimit: *labelValueLengthLimit,
+		SeriesLimitPolicy:     *seriesLimitPolicy,
+		HostsLimit:            *hostsLimit,
+		HostsRankBy:           *hostsRankBy,
+		StepsLimit:            *stepsLimit,
+
+		IdempotencyTTL: *idempotencyTTL,
+
+		WebhookMaxBodySize:    int64(*maxBodySize),
+		WebhookMaxDecodedSize: int64(*maxDecodedSize),
+		WebhookRateLimit:      *rateLimit,
+		WebhookRateBurst:      *rateBurst,
+
+		IngestWorkers:   *ingestWorkers,
+		IngestQueueSize: *ingestQueueSize,
+
+		PersistenceFile:     *persistenceFile,
+		PersistenceInterval: *persistenceInterval,
+
+		JournalDir:      *journalDir,
+		JournalMaxSize:  int64(*journalMaxSize),
+		JournalMaxFiles: *journalMaxFiles,
+
+		ReplicationPeers:      *replicationPeers,
+		ReplicationInstanceID: *replicationInstanceID,
+		ReplicationSecret:     *replicationSecret,
+
+		AlertmanagerURLs:           *alertmanagerURLs,
+		AlertmanagerResendInterval: *alertmanagerResendInterval,
+		AlertmanagerTestURL:        *alertmanagerTestURL,
+
+		ParseNodeNames:    *parseNodeNames,
+		DropNodeNameLabel: *dropNodeName,
+	}
+	if *persistenceInterval <= 0 {
+		level.Error(logger).Log("msg", "--persistence.interval must be positive", "interval", *persistenceInterval)
+		os.Exit(1)
+	}
+	if *ingestWorkers < 0 || *ingestQueueSize < 0 {
+		level.Error(logger).Log("msg", "--ingest.workers and --ingest.queue-size must not be negative", "workers", *ingestWorkers, "queue_size", *ingestQueueSize)
+		os.Exit(1)
+	}
+	if len(cfg.ReplicationPeers) > 0 && cfg.ReplicationSecret == "" {
+		level.Error(logger).Log("msg", "--replication.secret is required with --replication.peer")
+		os.Exit(1)
+	}
+	if cfg.ReplicationInstanceID == "" {
+		cfg.ReplicationInstanceID, _ = os.Hostname()
 	}
 
-	collector := collector.NewCollector(logger, cfg)
-	prometheus.MustRegister(collector)
+	fileCfg := &collector.FileConfig{}
+	if *configFile != "" {
+		var err error
+		if fileCfg, err = collector.LoadConfigFile(*configFile); err != nil {
+			level.Error(logger).Log("msg", "Failed to load config file", "path", *configFile, "err", err)
+			os.Exit(1)
+		}
+	}
+	if *nodeLookupFile != "" {
+		var err error
+		if cfg.NodeLookup, err = collector.LoadNodeLookup(*nodeLookupFile); err != nil {
+			level.Error(logger).Log("msg", "Failed to load node lookup file", "path", *nodeLookupFile, "err", err)
+			os.Exit(1)
+		}
+	}
+	cfg.Filters = fileCfg.Filters
+	cfg.RelabelConfigs = fileCfg.RelabelConfigs
+	cfg.TestTypes = collector.MergeTestTypes(fileCfg.TestTypes)
+	sources, err := collector.NewSourcePolicy(fileCfg.Sources)
+	if err != nil {
+		level.Error(logger).Log("msg", "Invalid webhook sources", "err", err)
+		os.Exit(1)
+	}
+	cfg.Sources = sources
 
-	// HTTP Server setup
-	http.Handle("/metrics", promhttp.Handler())
-	http.HandleFunc(*webhookPath, collector.HandleWebhook)
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/html")
-		fmt.Fprintf(w, landingPageHtml, "/metrics")
+	switch command {
+	case serveCmd.FullCommand():
+		serve(logger, cfg, fileCfg, *configFile, *enableLifecycle)
+	case replayCmd.FullCommand():
+		if err := replay(logger, cfg, fileCfg, *replayTenant, *replayJournal, *replayURL, *replaySecret); err != nil {
+			level.Error(logger).Log("msg", "Replay failed", "err", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func serve(logger log.Logger, cfg *collector.Config, fileCfg *collector.FileConfig, configFile string, enableLifecycle bool) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Webhooks are rejected with 503 until every collector restored its state.
+	var (
+		ready    atomic.Bool
+		restored sync.WaitGroup
+	)
+	http.HandleFunc(healthyPath, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Healthy")
+	})
+	http.HandleFunc(readyPath, func(w http.ResponseWriter, r *http.Request) {
+		if !ready.Load() {
+			http.Error(w, "Not ready", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "Ready")
 	})
 
-	level.Info(logger).Log("msg", "Starting Catchpoint Exporter", "port", *port)
-	level.Error(logger).Log("msg", http.ListenAndServe(":"+*port, nil))
+	// Without tenants a single collector serves the status page and API at
+	// the root. Every tenant gets its own collector, mounted below /tenants/.
+	var collectors []*collector.Collector
+	if len(fileCfg.Tenants) == 0 {
+		c, closeCollector := startCollector(logger, cfg, &restored)
+		defer closeCollector()
+		collectors = append(collectors, c)
+		prometheus.MustRegister(c)
+		http.HandleFunc(cfg.WebhookPath, c.HandleWebhook)
+		http.HandleFunc(cfg.AlertWebhookPath, c.HandleAlertWebhook)
+		handleCollector(http.DefaultServeMux, c)
+	} else {
+		for _, tenant := range fileCfg.Tenants {
+			tenantCfg := tenant.Apply(cfg)
+			c, closeCollector := startCollector(logger, tenantCfg, &restored)
+			defer closeCollector()
+			collectors = append(collectors, c)
+			if tenant.MetricsEndpoint {
+				registry := prometheus.NewRegistry()
+				registry.MustRegister(c)
+				http.Handle(tenantCfg.MetricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+			} else {
+				prometheus.MustRegister(c)
+			}
+
+			http.HandleFunc(tenantCfg.WebhookPath, c.HandleWebhook)
+			http.HandleFunc(tenantCfg.AlertWebhookPath, c.HandleAlertWebhook)
+			prefix := "/tenants/" + tenant.Name
+			mux := http.NewServeMux()
+			handleCollector(mux, c)
+			http.Handle(prefix+"/", http.StripPrefix(prefix, mux))
+		}
+		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			tenantsPage.Execute(w, fileCfg.Tenants)
+		})
+	}
+	http.Handle(cfg.MetricsPath, promhttp.Handler())
+
+	reload := func() error {
+		if err := reloadSources(configFile, collectors); err != nil {
+			level.Error(logger).Log("msg", "Failed to reload config file", "path", configFile, "err", err)
+			return err
+		}
+		level.Info(logger).Log("msg", "Reloaded webhook sources", "path", configFile)
+		return nil
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for range hup {
+			reload()
+		}
+	}()
+	if enableLifecycle {
+		http.HandleFunc(reloadPath, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				http.Error(w, "Only POST requests allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			if err := reload(); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to reload config: %s", err), http.StatusInternalServerError)
+				return
+			}
+		})
+	}
+
+	// Event streams never finish on their own, so their request contexts are
+	// canceled when the server shuts down.
+	base, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		BaseContext:       func(net.Listener) context.Context { return base },
+	}
+	server.RegisterOnShutdown(cancelBase)
+
+	level.Info(logger).Log("msg", "Starting Catchpoint Exporter", "port", cfg.Port)
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			level.Error(logger).Log("msg", "HTTP server failed", "err", err)
+			stop()
+		}
+	}()
+
+	restored.Wait()
+	for _, c := range collectors {
+		c.Resume()
+	}
+	ready.Store(true)
+	level.Info(logger).Log("msg", "Catchpoint Exporter is ready")
+
+	<-ctx.Done()
+	// A second signal terminates immediately.
+	stop()
+	ready.Store(false)
+	for _, c := range collectors {
+		c.Drain()
+	}
+	if cfg.DrainPeriod > 0 {
+		level.Info(logger).Log("msg", "Draining before shutdown", "period", cfg.DrainPeriod)
+		time.Sleep(cfg.DrainPeriod)
+	}
+
+	level.Info(logger).Log("msg", "Shutting down Catchpoint Exporter")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		level.Warn(logger).Log("msg", "Failed to finish in-flight requests", "err", err)
+	}
 }
 
-const (
-	landingPageHtml = `<html>
+// reloadSources reads configFile and applies its webhook sources to the
+// collectors. Other settings require a restart.
+func reloadSources(configFile string, collectors []*collector.Collector) error {
+	if configFile == "" {
+		return nil
+	}
+	fileCfg, err := collector.LoadConfigFile(configFile)
+	if err != nil {
+		return err
+	}
+	sources, err := collector.NewSourcePolicy(fileCfg.Sources)
+	if err != nil {
+		return err
+	}
+	for _, c := range collectors {
+		c.SetSources(sources)
+	}
+	return nil
+}
+
+// startCollector creates a collector for cfg and restores its state in the
+// background, marking restored as done afterwards. Until then the collector
+// rejects webhooks. The returned function processes queued webhooks, writes
+// the final snapshot and closes the collector's journal and replicator.
+func startCollector(logger log.Logger, cfg *collector.Config, restored *sync.WaitGroup) (*collector.Collector, func()) {
+	if tenant := cfg.Labels[collector.TenantLabel]; tenant != "" {
+		logger = log.With(logger, "tenant", tenant)
+	}
+	c := collector.NewCollector(logger, cfg)
+	c.Drain()
+
+	var closers []func()
+	if cfg.JournalDir != "" {
+		journal, err := collector.OpenJournal(cfg.JournalDir, cfg.JournalMaxSize, cfg.JournalMaxFiles)
+		if err != nil {
+			level.Error(logger).Log("msg", "Failed to open journal", "dir", cfg.JournalDir, "err", err)
+			os.Exit(1)
+		}
+		closers = append(closers, func() {
+			if err := journal.Close(); err != nil {
+				level.Error(logger).Log("msg", "Failed to close journal", "dir", cfg.JournalDir, "err", err)
+			}
+		})
+		c.SetJournal(journal)
+	}
+
+	if len(cfg.ReplicationPeers) > 0 {
+		replicator := collector.NewReplicator(logger, cfg.ReplicationInstanceID, cfg.ReplicationPeers, cfg.ReplicationSecret, cfg.Secret)
+		closers = append(closers, replicator.Close)
+		c.SetReplicator(replicator)
+	}
+
+	if len(cfg.AlertmanagerURLs) > 0 {
+		notifier := collector.NewAlertmanagerNotifier(logger, cfg.AlertmanagerURLs, cfg.AlertmanagerResendInterval, cfg.AlertmanagerTestURL, cfg.Labels, c.ActiveAlerts)
+		closers = append(closers, notifier.Close)
+		c.SetAlertmanager(notifier)
+	}
+
+	ctx, stopPersisting := context.WithCancel(context.Background())
+	persisted := make(chan struct{})
+	restored.Add(1)
+	go func() {
+		defer close(persisted)
+		if cfg.PersistenceFile == "" {
+			restored.Done()
+			return
+		}
+		if err := c.LoadState(cfg.PersistenceFile); err != nil {
+			level.Error(logger).Log("msg", "Failed to restore state", "path", cfg.PersistenceFile, "err", err)
+		}
+		restored.Done()
+		c.PersistState(ctx, cfg.PersistenceFile, cfg.PersistenceInterval)
+	}()
+
+	return c, func() {
+		// Queued webhooks are processed before the final snapshot is written.
+		c.Close()
+		stopPersisting()
+		<-persisted
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+	}
+}
+
+// handleCollector registers the query API, stream and status page of c.
+func handleCollector(mux *http.ServeMux, c *collector.Collector) {
+	mux.Handle("/", c.StatusHandler(version))
+	mux.HandleFunc(collector.APITestsPath, c.HandleTests)
+	mux.HandleFunc(collector.APITestsPrefix, c.HandleTestResults)
+	mux.HandleFunc(collector.StreamPath, c.HandleStream)
+}
+
+var tenantsPage = template.Must(template.New("tenants").Parse(`<html>
 <head><title>Catchpoint Exporter</title></head>
 <body>
 	<h1>Catchpoint Exporter</h1>
-	<p><a href='%s'>Metrics</a></p>
+	<p><a href='/metrics'>Metrics</a></p>
+	<ul>
+	{{range .}}<li><a href='/tenants/{{.Name}}/'>{{.Name}}</a></li>
+	{{end}}</ul>
 </body>
-</html>`
+</html>`))
+
+const (
+	healthyPath = "/-/healthy"
+	readyPath   = "/-/ready"
+	reloadPath  = "/-/reload"
+
+	version = "1.0.0"
 )
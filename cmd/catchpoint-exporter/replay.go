@@ -0,0 +1,111 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"catchpoint-prometheus-exporter/collector"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// replay feeds every body in the journal at dir through the ingestion path.
+// With a tenant, the tenant's configuration from fileCfg is applied first.
+// With a URL the bodies are posted to that webhook endpoint instead, with
+// secret or else the tenant's secret as bearer token. Otherwise they are
+// ingested locally and the rebuilt state is written to the persistence file,
+// if one is configured.
+func replay(logger log.Logger, cfg *collector.Config, fileCfg *collector.FileConfig, tenant, dir, url, secret string) error {
+	var (
+		ingest   func(collector.JournalEntry) error
+		accepted int
+		rejected int
+	)
+
+	if tenant != "" {
+		found := false
+		for _, t := range fileCfg.Tenants {
+			if t.Name == tenant {
+				cfg, found = t.Apply(cfg), true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown tenant %q", tenant)
+		}
+	}
+	if secret == "" {
+		secret = cfg.Secret
+	}
+
+	c := collector.NewCollector(logger, cfg)
+	defer c.Close()
+	if url != "" {
+		client := &http.Client{Timeout: 30 * time.Second}
+		ingest = func(entry collector.JournalEntry) error {
+			req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(entry.Body))
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if secret != "" {
+				req.Header.Set("Authorization", "Bearer "+secret)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+				return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+			}
+			return nil
+		}
+	} else {
+		ingest = func(entry collector.JournalEntry) error {
+			_, err := c.Ingest(entry.Body, entry.Time)
+			return err
+		}
+	}
+
+	err := collector.ReadJournal(logger, dir, func(entry collector.JournalEntry) error {
+		if err := ingest(entry); err != nil {
+			rejected++
+			level.Warn(logger).Log("msg", "Replayed webhook was rejected", "received_at", entry.Time, "err", err)
+			return nil
+		}
+		accepted++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	level.Info(logger).Log("msg", "Replay finished", "accepted", accepted, "rejected", rejected)
+
+	if url == "" && cfg.PersistenceFile != "" {
+		if err := c.SaveState(cfg.PersistenceFile); err != nil {
+			return err
+		}
+		level.Info(logger).Log("msg", "Wrote replayed state", "path", cfg.PersistenceFile)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+const (
+	// AlertmanagerAlertName is the alertname label of forwarded alerts.
+	AlertmanagerAlertName = "CatchpointAlert"
+	// AlertmanagerAlertsPath is the Alertmanager API path alerts are posted to.
+	AlertmanagerAlertsPath = "/api/v2/alerts"
+
+	alertmanagerQueueSize = 1024
+	alertmanagerTimeout   = 10 * time.Second
+	// alertmanagerEndsAtFactor is how many resend intervals a firing alert
+	// stays active in Alertmanager without being resent, so a few failed
+	// resends do not resolve it.
+	alertmanagerEndsAtFactor = 4
+)
+
+// alertmanagerAlert is an alert in the format of the Alertmanager v2 API.
+type alertmanagerAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     string            `json:"startsAt,omitempty"`
+	EndsAt       string            `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// AlertmanagerNotifier posts the alerts received on the alert webhook to
+// Alertmanager. Alerts are sent when they trigger, change level or clear, and
+// active alerts are resent every resend interval so Alertmanager keeps them
+// firing. A level change resolves the alert of the previous level, as the
+// level is the severity label.
+type AlertmanagerNotifier struct {
+	logger         log.Logger
+	urls           []string
+	resendInterval time.Duration
+	testURL        string
+	labels         map[string]string
+	source         func() []ActiveAlert
+	client         *http.Client
+	queue          chan []alertmanagerAlert
+	wg             sync.WaitGroup
+}
+
+// NewAlertmanagerNotifier starts sending alerts to the given Alertmanager
+// URLs. Active alerts are read from source every resendInterval; a
+// resendInterval that is not positive disables resending. testURL links
+// alerts back to Catchpoint, with {test_id} replaced by the test ID. labels
+// are added to every alert.
+func NewAlertmanagerNotifier(logger log.Logger, urls []string, resendInterval time.Duration, testURL string, labels map[string]string, source func() []ActiveAlert) *AlertmanagerNotifier {
+	n := &AlertmanagerNotifier{
+		logger:         logger,
+		urls:           make([]string, 0, len(urls)),
+		resendInterval: resendInterval,
+		testURL:        testURL,
+		labels:         labels,
+		source:         source,
+		client:         &http.Client{Timeout: alertmanagerTimeout},
+		queue:          make(chan []alertmanagerAlert, alertmanagerQueueSize),
+	}
+	for _, url := range urls {
+		n.urls = append(n.urls, strings.TrimSuffix(url, "/")+AlertmanagerAlertsPath)
+	}
+	n.wg.Add(1)
+	go n.run()
+	return n
+}
+
+// Close stops resending and waits until all queued alerts are sent.
+func (n *AlertmanagerNotifier) Close() {
+	close(n.queue)
+	n.wg.Wait()
+}
+
+// notify queues the alerts for an alert update.
+func (n *AlertmanagerNotifier) notify(update alertUpdate) {
+	var alerts []alertmanagerAlert
+	if update.previous.Level != "" && update.previous.Level != update.current.Level {
+		alerts = append(alerts, n.alert(&update.previous, update.current.UpdatedAt))
+	}
+	if update.current.Level != "" {
+		alerts = append(alerts, n.alert(&update.current, time.Time{}))
+	}
+	if len(alerts) == 0 {
+		return
+	}
+	select {
+	case n.queue <- alerts:
+	default:
+		n.logger.Log("level", "warn", "msg", "Alertmanager queue full, dropping alerts", "test_id", update.current.TestDetails.TestId)
+	}
+}
+
+func (n *AlertmanagerNotifier) run() {
+	defer n.wg.Done()
+
+	var resend <-chan time.Time
+	if n.resendInterval > 0 {
+		ticker := time.NewTicker(n.resendInterval)
+		defer ticker.Stop()
+		resend = ticker.C
+	}
+	for {
+		select {
+		case alerts, ok := <-n.queue:
+			if !ok {
+				return
+			}
+			n.send(alerts)
+		case <-resend:
+			var alerts []alertmanagerAlert
+			for _, active := range n.source() {
+				alerts = append(alerts, n.alert(&active, time.Time{}))
+			}
+			if len(alerts) > 0 {
+				n.send(alerts)
+			}
+		}
+	}
+}
+
+// alert converts a to the Alertmanager format. A zero resolvedAt marks a
+// firing alert.
+func (n *AlertmanagerNotifier) alert(a *ActiveAlert, resolvedAt time.Time) alertmanagerAlert {
+	d := &a.TestDetails
+	labels := make(map[string]string, len(n.labels)+9)
+	for name, value := range n.labels {
+		labels[name] = value
+	}
+	for name, value := range map[string]string{
+		"alertname":   AlertmanagerAlertName,
+		"alert_type":  a.AlertType,
+		"severity":    a.Level,
+		"test_id":     d.TestId,
+		"test_name":   d.TestName,
+		"node_id":     d.NodeId,
+		"division_id": d.DivisionId,
+		"client_id":   d.ClientId,
+	} {
+		if value != "" {
+			labels[name] = value
+		}
+	}
+
+	alert := alertmanagerAlert{
+		Labels: labels,
+		Annotations: map[string]string{
+			"summary":   fmt.Sprintf("Catchpoint %s alert %q for test %s on node %s", a.Level, a.AlertType, testName(d), d.NodeName),
+			"node_name": d.NodeName,
+		},
+		StartsAt: a.StartsAt.UTC().Format(time.RFC3339Nano),
+	}
+	if n.testURL != "" {
+		alert.GeneratorURL = strings.ReplaceAll(n.testURL, "{test_id}", d.TestId)
+		alert.Annotations["catchpoint_url"] = alert.GeneratorURL
+	}
+	switch {
+	case !resolvedAt.IsZero():
+		alert.EndsAt = resolvedAt.UTC().Format(time.RFC3339Nano)
+	case n.resendInterval > 0:
+		alert.EndsAt = time.Now().Add(alertmanagerEndsAtFactor * n.resendInterval).UTC().Format(time.RFC3339Nano)
+	}
+	return alert
+}
+
+func testName(d *TestDetails) string {
+	if d.TestName != "" {
+		return fmt.Sprintf("%q", d.TestName)
+	}
+	return d.TestId
+}
+
+func (n *AlertmanagerNotifier) send(alerts []alertmanagerAlert) {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		n.logger.Log("level", "error", "msg", "Failed to encode alerts", "error", err)
+		return
+	}
+	for _, url := range n.urls {
+		if err := n.post(url, body); err != nil {
+			n.logger.Log("level", "error", "msg", "Failed to send alerts to Alertmanager", "url", url, "error", err)
+		}
+	}
+}
+
+func (n *AlertmanagerNotifier) post(url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/promlog"
+)
+
+// stubAlertmanager records the alerts posted to its v2 API.
+type stubAlertmanager struct {
+	mu      sync.Mutex
+	batches [][]alertmanagerAlert
+}
+
+func (s *stubAlertmanager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != AlertmanagerAlertsPath {
+		http.NotFound(w, r)
+		return
+	}
+	var alerts []alertmanagerAlert
+	if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.batches = append(s.batches, alerts)
+	s.mu.Unlock()
+}
+
+func (s *stubAlertmanager) received() [][]alertmanagerAlert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]alertmanagerAlert(nil), s.batches...)
+}
+
+func TestAlertmanagerNotifier(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	stubs := []*stubAlertmanager{{}, {}}
+	var urls []string
+	for _, stub := range stubs {
+		server := httptest.NewServer(stub)
+		defer server.Close()
+		urls = append(urls, server.URL+"/")
+	}
+
+	collector := NewCollector(logger, &Config{Labels: map[string]string{TenantLabel: "acme"}})
+	notifier := NewAlertmanagerNotifier(logger, urls, 0, "https://catchpoint.example.com/tests/{test_id}", collector.cfg.Labels, collector.ActiveAlerts)
+	collector.SetAlertmanager(notifier)
+
+	postAlert(t, collector, "alert_warning.json")
+	postAlert(t, collector, "alert_critical.json")
+	// Late and repeated notifications are not forwarded.
+	postAlert(t, collector, "alert_warning.json")
+	postAlert(t, collector, "alert_improved.json")
+	notifier.Close()
+
+	for i, stub := range stubs {
+		batches := stub.received()
+		if len(batches) != 3 {
+			t.Fatalf("Alertmanager %d: expected 3 batches, got %+v", i, batches)
+		}
+
+		warning := batches[0][0]
+		expectedLabels := map[string]string{
+			"alertname":   AlertmanagerAlertName,
+			"alert_type":  "Test Response Time",
+			"severity":    AlertLevelWarning,
+			"test_id":     "123456",
+			"test_name":   "My Homepage",
+			"node_id":     "42",
+			"division_id": "1",
+			"client_id":   "1234",
+			TenantLabel:   "acme",
+		}
+		if len(warning.Labels) != len(expectedLabels) {
+			t.Errorf("expected labels %v, got %v", expectedLabels, warning.Labels)
+		}
+		for name, value := range expectedLabels {
+			if warning.Labels[name] != value {
+				t.Errorf("expected label %s=%q, got %q", name, value, warning.Labels[name])
+			}
+		}
+		if warning.StartsAt != "2024-05-02T21:15:44Z" || warning.EndsAt != "" {
+			t.Errorf("expected a firing warning, got %+v", warning)
+		}
+		if warning.Annotations["node_name"] != "Paris, FR - Orange" {
+			t.Errorf("expected the node name as annotation, got %+v", warning.Annotations)
+		}
+		if warning.GeneratorURL != "https://catchpoint.example.com/tests/123456" || warning.Annotations["catchpoint_url"] != warning.GeneratorURL {
+			t.Errorf("expected a link to the test, got %+v", warning)
+		}
+
+		// The escalation resolves the warning and fires a critical alert
+		// that keeps the original start time.
+		if len(batches[1]) != 2 {
+			t.Fatalf("expected a resolved and a firing alert, got %+v", batches[1])
+		}
+		resolved, critical := batches[1][0], batches[1][1]
+		if resolved.Labels["severity"] != AlertLevelWarning || resolved.EndsAt != "2024-05-02T21:20:44Z" {
+			t.Errorf("expected the warning to be resolved, got %+v", resolved)
+		}
+		if critical.Labels["severity"] != AlertLevelCritical || critical.StartsAt != "2024-05-02T21:15:44Z" || critical.EndsAt != "" {
+			t.Errorf("expected a firing critical alert, got %+v", critical)
+		}
+
+		if len(batches[2]) != 1 || batches[2][0].Labels["severity"] != AlertLevelCritical || batches[2][0].EndsAt != "2024-05-02T21:30:44Z" {
+			t.Errorf("expected the critical alert to be resolved, got %+v", batches[2])
+		}
+	}
+}
+
+func TestAlertmanagerResend(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	stub := &stubAlertmanager{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	collector := NewCollector(logger, &Config{})
+	notifier := NewAlertmanagerNotifier(logger, []string{server.URL}, 10*time.Millisecond, "", nil, collector.ActiveAlerts)
+	defer notifier.Close()
+	collector.SetAlertmanager(notifier)
+
+	postAlert(t, collector, "alert_critical.json")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(stub.received()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the active alert to be resent, got %+v", stub.received())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, batch := range stub.received() {
+		if len(batch) != 1 || batch[0].Labels["severity"] != AlertLevelCritical {
+			t.Fatalf("expected the critical alert, got %+v", batch)
+		}
+		endsAt, err := time.Parse(time.RFC3339Nano, batch[0].EndsAt)
+		if err != nil || !endsAt.After(time.Now()) {
+			t.Errorf("expected a firing alert to end in the future, got %q", batch[0].EndsAt)
+		}
+		if batch[0].GeneratorURL != "" {
+			t.Errorf("expected no link without a test URL, got %q", batch[0].GeneratorURL)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	AlertActiveMetric = "catchpoint_alert_active"
+	AlertsTotalMetric = "catchpoint_alerts_total"
+
+	AlertActiveDesc = "Catchpoint alert of a test and node that has not cleared yet, with value 1."
+	AlertsTotalDesc = "Number of Catchpoint alert notifications received by alert type and level."
+
+	alertTypeLabel = "alert_type"
+	levelLabel     = "level"
+	// nodeLabel carries the node ID of an alert, which unlike the node name
+	// does not change when a node is renamed.
+	nodeLabel = "node"
+)
+
+var errInvalidAlert = errors.New("invalid alert")
+
+type alertKey struct {
+	testID    string
+	nodeID    string
+	alertType string
+}
+
+type alertCount struct {
+	alertType string
+	level     string
+}
+
+// ActiveAlert is the state of an alert of a test and node. Level is
+// AlertLevelWarning or AlertLevelCritical while the alert is active.
+type ActiveAlert struct {
+	TestDetails TestDetails
+	AlertType   string
+	Level       string
+	// StartsAt is when the alert was first triggered. It is kept when the
+	// level changes between warning and critical.
+	StartsAt  time.Time
+	UpdatedAt time.Time
+}
+
+// alertStore keeps the state of the alerts received on the alert webhook.
+// Cleared alerts are kept with an empty level until they expire after the
+// TTL, so older notifications delivered late cannot trigger them again.
+//
+// The alerts are bounded by the total series limit: at the limit the least
+// recently updated cleared alert makes room for a new one, or with evict set
+// the least recently updated alert. Alert types are truncated to
+// maxValueLength bytes, and alert types beyond the series limit are counted
+// as alertTypeOther. onLimit, if set, is called with every limit hit.
+type alertStore struct {
+	mu             sync.Mutex
+	ttl            time.Duration
+	limits         seriesLimits
+	maxValueLength int
+	onLimit        func(limit string)
+	alerts         map[alertKey]*ActiveAlert
+	counts         map[alertCount]uint64
+	countedTypes   map[string]bool
+
+	activeMetric *prometheus.Desc
+	totalMetric  *prometheus.Desc
+}
+
+// alertTypeOther is the alert_type of catchpoint_alerts_total counting the
+// alert types beyond the series limit.
+const alertTypeOther = "__other__"
+
+func newAlertStore(constLabels prometheus.Labels, ttl time.Duration, limits seriesLimits, maxValueLength int) *alertStore {
+	return &alertStore{
+		ttl:            ttl,
+		limits:         limits,
+		maxValueLength: maxValueLength,
+		alerts:         make(map[alertKey]*ActiveAlert),
+		counts:         make(map[alertCount]uint64),
+		countedTypes:   make(map[string]bool),
+		activeMetric: prometheus.NewDesc(
+			AlertActiveMetric,
+			AlertActiveDesc,
+			[]string{testIDLabel, nodeLabel, alertTypeLabel, levelLabel},
+			constLabels,
+		),
+		totalMetric: prometheus.NewDesc(
+			AlertsTotalMetric,
+			AlertsTotalDesc,
+			[]string{alertTypeLabel, levelLabel},
+			constLabels,
+		),
+	}
+}
+
+// alertType returns the alert type name, or the type ID if there is none.
+func alertType(a *Alert) string {
+	if name := strings.TrimSpace(a.Type); name != "" {
+		return name
+	}
+	return a.TypeId
+}
+
+// alertUpdate is the state of an alert before and after a notification.
+type alertUpdate struct {
+	previous ActiveAlert
+	current  ActiveAlert
+}
+
+// update applies an alert notification received at now and returns its
+// outcome and the resulting change. The alert time is taken from the
+// notification, but never later than now. Notifications older than the stored
+// state of their alert are ignored as out of order, and new alerts without
+// room at the series limit are filtered.
+func (s *alertStore) update(resp *AlertResponse, now time.Time) (string, alertUpdate, error) {
+	level := strings.ToLower(strings.TrimSpace(resp.Alert.Level))
+	switch {
+	case resp.TestDetails.TestId == "":
+		return "", alertUpdate{}, fmt.Errorf("%w: TestId is required", errInvalidAlert)
+	case alertType(&resp.Alert) == "":
+		return "", alertUpdate{}, fmt.Errorf("%w: Type or TypeId is required", errInvalidAlert)
+	case level != AlertLevelWarning && level != AlertLevelCritical && level != AlertLevelImproved:
+		return "", alertUpdate{}, fmt.Errorf("%w: unknown level %q", errInvalidAlert, resp.Alert.Level)
+	}
+	t := now
+	if alertTime, ok := resp.Alert.Time(); ok && alertTime.Before(now) {
+		t = alertTime
+	}
+
+	key := alertKey{
+		testID:    resp.TestDetails.TestId,
+		nodeID:    resp.TestDetails.NodeId,
+		alertType: s.truncate(alertType(&resp.Alert)),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(now)
+	s.count(key.alertType, level)
+	alert, ok := s.alerts[key]
+	if !ok {
+		if !s.admit() {
+			return OutcomeFiltered, alertUpdate{}, nil
+		}
+		alert = &ActiveAlert{AlertType: key.alertType}
+		s.alerts[key] = alert
+	} else if t.Before(alert.UpdatedAt) {
+		return OutcomeOutOfOrder, alertUpdate{}, nil
+	}
+	previous := *alert
+	if level == AlertLevelImproved {
+		level = ""
+	} else if alert.Level == "" {
+		alert.StartsAt = t
+	}
+	alert.TestDetails = resp.TestDetails
+	alert.Level = level
+	alert.UpdatedAt = t
+	return OutcomeAccepted, alertUpdate{previous: previous, current: *alert}, nil
+}
+
+// truncate cuts an alert type at the label value length limit.
+func (s *alertStore) truncate(value string) string {
+	if s.maxValueLength <= 0 || len(value) <= s.maxValueLength {
+		return value
+	}
+	s.limitHit(limitLabelValueLength)
+	return strings.ToValidUTF8(value[:s.maxValueLength], "")
+}
+
+func (s *alertStore) limitHit(limit string) {
+	if s.onLimit != nil {
+		s.onLimit(limit)
+	}
+}
+
+// count counts a notification of alertType and level. It must be called with
+// s.mu held.
+func (s *alertStore) count(alertType, level string) {
+	if !s.countedTypes[alertType] {
+		if s.limits.total > 0 && len(s.countedTypes) >= s.limits.total {
+			alertType = alertTypeOther
+		} else {
+			s.countedTypes[alertType] = true
+		}
+	}
+	s.counts[alertCount{alertType: alertType, level: level}]++
+}
+
+// admit makes room for a new alert at the series limit and reports whether it
+// may be stored. It must be called with s.mu held.
+func (s *alertStore) admit() bool {
+	if s.limits.total <= 0 || len(s.alerts) < s.limits.total {
+		return true
+	}
+	s.limitHit(limitSeries)
+	if s.evictOldest(func(a *ActiveAlert) bool { return a.Level == "" }) {
+		return true
+	}
+	return s.limits.evict && s.evictOldest(func(*ActiveAlert) bool { return true })
+}
+
+// evictOldest removes the least recently updated alert matching fn and
+// reports whether there was one. It must be called with s.mu held.
+func (s *alertStore) evictOldest(fn func(*ActiveAlert) bool) bool {
+	var (
+		oldest alertKey
+		found  *ActiveAlert
+	)
+	for key, alert := range s.alerts {
+		if fn(alert) && (found == nil || alert.UpdatedAt.Before(found.UpdatedAt)) {
+			oldest, found = key, alert
+		}
+	}
+	if found != nil {
+		delete(s.alerts, oldest)
+	}
+	return found != nil
+}
+
+// expire drops cleared alerts not updated within the TTL. It must be called
+// with s.mu held.
+func (s *alertStore) expire(now time.Time) {
+	if s.ttl <= 0 {
+		return
+	}
+	for key, alert := range s.alerts {
+		if alert.Level == "" && now.Sub(alert.UpdatedAt) > s.ttl {
+			delete(s.alerts, key)
+		}
+	}
+}
+
+// list returns copies of the active alerts ordered by test, node and type.
+func (s *alertStore) list() []ActiveAlert {
+	s.mu.Lock()
+	var alerts []ActiveAlert
+	for _, alert := range s.alerts {
+		if alert.Level != "" {
+			alerts = append(alerts, *alert)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(alerts, func(i, j int) bool {
+		a, b := &alerts[i], &alerts[j]
+		if a.TestDetails.TestId != b.TestDetails.TestId {
+			return a.TestDetails.TestId < b.TestDetails.TestId
+		}
+		if a.TestDetails.NodeId != b.TestDetails.NodeId {
+			return a.TestDetails.NodeId < b.TestDetails.NodeId
+		}
+		return a.AlertType < b.AlertType
+	})
+	return alerts
+}
+
+func (s *alertStore) collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	s.expire(time.Now())
+	s.mu.Unlock()
+
+	for _, active := range s.list() {
+		ch <- prometheus.MustNewConstMetric(s.activeMetric, prometheus.GaugeValue, 1,
+			active.TestDetails.TestId, active.TestDetails.NodeId, active.AlertType, active.Level)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for count, value := range s.counts {
+		ch <- prometheus.MustNewConstMetric(s.totalMetric, prometheus.CounterValue, float64(value), count.alertType, count.level)
+	}
+}
+
+// ActiveAlerts returns the active alerts ordered by test, node and type.
+func (c *Collector) ActiveAlerts() []ActiveAlert {
+	return c.alerts.list()
+}
+
+// HandleAlertWebhook receives Catchpoint alert webhooks and updates the alert
+// state exported as catchpoint_alert_active. It applies the same checks as
+// HandleWebhook.
+func (c *Collector) HandleAlertWebhook(w http.ResponseWriter, r *http.Request) {
+	if c == nil {
+		writeAPIError(w, http.StatusInternalServerError, "collector instance is uninitialized")
+		return
+	}
+	body, ok := c.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	var resp AlertResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		c.logger.Log("level", "warn", "msg", "Failed to decode alert webhook", "error", err)
+		c.reject(body, err, now)
+		writeAPIError(w, http.StatusBadRequest, "invalid alert payload")
+		return
+	}
+	if !c.clientAllowed(resp.TestDetails.ClientId) {
+		err := fmt.Errorf("%w: %q", errClientNotAllowed, resp.TestDetails.ClientId)
+		c.logger.Log("level", "warn", "msg", "Rejected alert webhook from disallowed client", "clientID", resp.TestDetails.ClientId)
+		c.reject(body, err, now)
+		writeAPIError(w, http.StatusForbidden, errClientNotAllowed.Error())
+		return
+	}
+	outcome, update, err := c.alerts.update(&resp, now)
+	if err != nil {
+		c.logger.Log("level", "warn", "msg", "Rejected alert webhook", "error", err)
+		c.reject(body, err, now)
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if outcome == OutcomeAccepted && c.alertmanager != nil {
+		c.alertmanager.notify(update)
+	}
+	if c.cfg.VerboseLogging {
+		c.logger.Log("level", "debug", "msg", "Received alert", "test_id", resp.TestDetails.TestId, "node_id", resp.TestDetails.NodeId, "alert_type", alertType(&resp.Alert), "level", resp.Alert.Level, "outcome", outcome)
+	}
+	writeJSON(w, http.StatusOK, apiResponse{Status: apiStatusSuccess, Data: WebhookResult{Outcome: outcome}})
+}
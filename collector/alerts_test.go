@@ -0,0 +1,198 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+)
+
+func postAlert(t *testing.T, c *Collector, file string) webhookReply {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal("failed to read alert payload:", err)
+	}
+	w := httptest.NewRecorder()
+	c.HandleAlertWebhook(w, httptest.NewRequest("POST", "/webhook/alerts", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for %s, got %d: %s", file, w.Code, w.Body)
+	}
+	return decodeWebhookReply(t, w)
+}
+
+func TestAlertWebhook(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	postAlert(t, collector, "alert_warning.json")
+	postAlert(t, collector, "alert_critical.json")
+	// The warning was delivered again after the escalation.
+	if reply := postAlert(t, collector, "alert_warning.json"); reply.Data.Outcome != OutcomeOutOfOrder {
+		t.Errorf("expected the late warning to be ignored, got %+v", reply)
+	}
+
+	expected := `
+# HELP catchpoint_alert_active Catchpoint alert of a test and node that has not cleared yet, with value 1.
+# TYPE catchpoint_alert_active gauge
+catchpoint_alert_active{alert_type="Test Response Time",level="critical",node="42",test_id="123456"} 1
+# HELP catchpoint_alerts_total Number of Catchpoint alert notifications received by alert type and level.
+# TYPE catchpoint_alerts_total counter
+catchpoint_alerts_total{alert_type="Test Response Time",level="critical"} 1
+catchpoint_alerts_total{alert_type="Test Response Time",level="warning"} 2
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), AlertActiveMetric, AlertsTotalMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+	if alerts := collector.alerts.list(); len(alerts) != 1 || alerts[0].StartsAt.Format("150405") != "211544" {
+		t.Errorf("expected the alert to keep its first trigger time, got %+v", alerts)
+	}
+
+	postAlert(t, collector, "alert_improved.json")
+	// A trigger older than the clear must not reactivate the alert.
+	postAlert(t, collector, "alert_critical.json")
+
+	expected = `
+# HELP catchpoint_alerts_total Number of Catchpoint alert notifications received by alert type and level.
+# TYPE catchpoint_alerts_total counter
+catchpoint_alerts_total{alert_type="Test Response Time",level="critical"} 2
+catchpoint_alerts_total{alert_type="Test Response Time",level="improved"} 1
+catchpoint_alerts_total{alert_type="Test Response Time",level="warning"} 2
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), AlertActiveMetric, AlertsTotalMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+}
+
+// postAlertBody sends an alert of the given type, level and timestamp and
+// returns the outcome.
+func postAlertBody(t *testing.T, c *Collector, alertType, level, timestamp string) string {
+	t.Helper()
+	body := fmt.Sprintf(`{"TestDetails":{"TestId":"1","NodeId":"42"},"Alert":{"Type":%q,"Level":%q,"Timestamp":%q}}`, alertType, level, timestamp)
+	w := httptest.NewRecorder()
+	c.HandleAlertWebhook(w, httptest.NewRequest("POST", "/webhook/alerts", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	return decodeWebhookReply(t, w).Data.Outcome
+}
+
+func TestAlertFutureTimestampClamped(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{})
+
+	future := time.Now().Add(24 * time.Hour).UTC().Format("20060102150405")
+	postAlertBody(t, collector, "Availability", "Warning", future)
+	// Timestamps have second precision, so round up past the receipt time of
+	// the first notification.
+	later := time.Now().Add(time.Second).UTC().Format("20060102150405")
+	if outcome := postAlertBody(t, collector, "Availability", "Improved", later); outcome != OutcomeAccepted {
+		t.Errorf("expected a future-dated alert not to hold back later ones, got %s", outcome)
+	}
+}
+
+func TestAlertLimits(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{SeriesLimit: 2, LabelValueLengthLimit: 8, SeriesTTL: time.Minute})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	now := time.Now().UTC().Format("20060102150405")
+	postAlertBody(t, collector, "Availability", "Warning", now)
+	postAlertBody(t, collector, "Response Time", "Warning", now)
+	if outcome := postAlertBody(t, collector, "Byte Length", "Warning", now); outcome != OutcomeFiltered {
+		t.Errorf("expected a new alert beyond the series limit to be filtered, got %s", outcome)
+	}
+
+	expected := `
+# HELP catchpoint_alert_active Catchpoint alert of a test and node that has not cleared yet, with value 1.
+# TYPE catchpoint_alert_active gauge
+catchpoint_alert_active{alert_type="Availabi",level="warning",node="42",test_id="1"} 1
+catchpoint_alert_active{alert_type="Response",level="warning",node="42",test_id="1"} 1
+# HELP catchpoint_alerts_total Number of Catchpoint alert notifications received by alert type and level.
+# TYPE catchpoint_alerts_total counter
+catchpoint_alerts_total{alert_type="Availabi",level="warning"} 1
+catchpoint_alerts_total{alert_type="Response",level="warning"} 1
+catchpoint_alerts_total{alert_type="__other__",level="warning"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), AlertActiveMetric, AlertsTotalMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+
+	// A cleared alert makes room for a new one.
+	postAlertBody(t, collector, "Availability", "Improved", now)
+	if outcome := postAlertBody(t, collector, "Byte Length", "Warning", now); outcome != OutcomeAccepted {
+		t.Errorf("expected the cleared alert to make room, got %s", outcome)
+	}
+
+	// Cleared alerts expire after the TTL.
+	postAlertBody(t, collector, "Response Time", "Improved", now)
+	collector.alerts.mu.Lock()
+	collector.alerts.expire(time.Now().Add(2 * time.Minute))
+	remaining := len(collector.alerts.alerts)
+	collector.alerts.mu.Unlock()
+	if remaining != 1 {
+		t.Errorf("expected only the active alert to remain, got %d alerts", remaining)
+	}
+}
+
+func TestAlertWebhookInvalid(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{AllowedClientIDs: []string{"1234"}})
+
+	for name, test := range map[string]struct {
+		body     string
+		expected int
+	}{
+		"malformed":     {`{invalid`, http.StatusBadRequest},
+		"unknown level": {`{"TestDetails":{"TestId":"1","ClientId":"1234"},"Alert":{"Type":"Availability","Level":"Major"}}`, http.StatusBadRequest},
+		"missing test":  {`{"TestDetails":{"ClientId":"1234"},"Alert":{"Type":"Availability","Level":"Warning"}}`, http.StatusBadRequest},
+		"other client":  {`{"TestDetails":{"TestId":"1","ClientId":"1"},"Alert":{"Type":"Availability","Level":"Warning"}}`, http.StatusForbidden},
+	} {
+		w := httptest.NewRecorder()
+		collector.HandleAlertWebhook(w, httptest.NewRequest("POST", "/webhook/alerts", strings.NewReader(test.body)))
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", name, test.expected, w.Code)
+		}
+	}
+	if alerts := collector.alerts.list(); len(alerts) != 0 {
+		t.Errorf("expected no alerts, got %+v", alerts)
+	}
+	// Rejected alerts are counted and shown on the status page like rejected
+	// test data.
+	if got := collector.webhooksRejected.Load(); got != 4 {
+		t.Errorf("expected 4 rejected webhooks, got %d", got)
+	}
+	if rejections := collector.history.recentRejections(); len(rejections) != 4 {
+		t.Errorf("expected 4 recent rejections, got %+v", rejections)
+	}
+}
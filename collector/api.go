@@ -0,0 +1,94 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// APITestsPath lists known tests. Results of a single test are served
+	// below it at /api/v1/tests/{test_id}/results.
+	APITestsPath     = "/api/v1/tests"
+	APITestsPrefix   = APITestsPath + "/"
+	apiResultsSuffix = "/results"
+	apiStatusSuccess = "success"
+	apiStatusError   = "error"
+)
+
+// apiResponse is the envelope of all JSON API responses.
+type apiResponse struct {
+	Status string      `json:"status"`
+	Data   interface{} `json:"data,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// HandleTests serves GET /api/v1/tests.
+func (c *Collector) HandleTests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, c.history.testSummaries())
+}
+
+// HandleTestResults serves GET /api/v1/tests/{test_id}/results. The optional
+// limit query parameter caps the number of results returned per node.
+func (c *Collector) HandleTestResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	testID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, APITestsPrefix), apiResultsSuffix)
+	if !ok || testID == "" || strings.Contains(testID, "/") {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeAPIError(w, http.StatusBadRequest, "invalid limit: "+v)
+			return
+		}
+		limit = n
+	}
+
+	results, ok := c.history.results(testID, limit)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "unknown test: "+testID)
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, results)
+}
+
+func writeAPIResponse(w http.ResponseWriter, code int, data interface{}) {
+	writeJSON(w, code, apiResponse{Status: apiStatusSuccess, Data: data})
+}
+
+func writeAPIError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, apiResponse{Status: apiStatusError, Error: msg})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/promlog"
+)
+
+// postWebhook sends resp to the collector's webhook handler and returns the recorder.
+func postWebhook(t *testing.T, c *Collector, resp Response) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal("failed to marshal response:", err)
+	}
+	req := httptest.NewRequest("POST", "http://example.com/webhook", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	c.HandleWebhook(w, req)
+	return w
+}
+
+// testResponse returns a result of the given test and node. The node ID is
+// the node name, so results of different nodes have different node IDs.
+func testResponse(testID, nodeName, totalTime string) Response {
+	return Response{
+		TestDetails: TestDetails{
+			TestName: "My Homepage",
+			TestId:   testID,
+			NodeId:   nodeName,
+			NodeName: nodeName,
+		},
+		Summary: Summary{TotalTime: totalTime},
+	}
+}
+
+func TestAPIResults(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{HistorySize: 2})
+
+	postWebhook(t, collector, testResponse("1", "Bangalore", "100"))
+	postWebhook(t, collector, testResponse("1", "Bangalore", "200"))
+	postWebhook(t, collector, testResponse("1", "Bangalore", "300"))
+	postWebhook(t, collector, testResponse("1", "Paris", "400"))
+	postWebhook(t, collector, testResponse("2", "Paris", "500"))
+
+	w := httptest.NewRecorder()
+	collector.HandleTests(w, httptest.NewRequest("GET", "/api/v1/tests", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var tests struct {
+		Status string        `json:"status"`
+		Data   []TestSummary `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&tests); err != nil {
+		t.Fatal("failed to decode tests:", err)
+	}
+	if len(tests.Data) != 2 || tests.Data[0].TestId != "1" || len(tests.Data[0].Nodes) != 2 {
+		t.Fatalf("unexpected tests: %+v", tests.Data)
+	}
+
+	w = httptest.NewRecorder()
+	collector.HandleTestResults(w, httptest.NewRequest("GET", "/api/v1/tests/1/results", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var results struct {
+		Status string        `json:"status"`
+		Data   []NodeResults `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatal("failed to decode results:", err)
+	}
+	if len(results.Data) != 2 {
+		t.Fatalf("expected 2 nodes, got %d", len(results.Data))
+	}
+	bangalore := results.Data[0].Results
+	if len(bangalore) != 2 || bangalore[0].Response.Summary.TotalTime != "300" || bangalore[1].Response.Summary.TotalTime != "200" {
+		t.Errorf("expected the two newest results newest first, got %+v", bangalore)
+	}
+
+	w = httptest.NewRecorder()
+	collector.HandleTestResults(w, httptest.NewRequest("GET", "/api/v1/tests/1/results?limit=1", nil))
+	results.Data = nil
+	if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+		t.Fatal("failed to decode results:", err)
+	}
+	if len(results.Data[0].Results) != 1 {
+		t.Errorf("expected limit to cap results, got %d", len(results.Data[0].Results))
+	}
+
+	w = httptest.NewRecorder()
+	collector.HandleTestResults(w, httptest.NewRequest("GET", "/api/v1/tests/3/results", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown test, got %d", w.Code)
+	}
+}
+
+func TestHistoryPrunedWithSeries(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{HistorySize: 2, SeriesTTL: time.Minute, SeriesLimit: 2, SeriesLimitPolicy: LimitPolicyEvict})
+
+	postWebhook(t, collector, testResponse("1", "Bangalore", "100"))
+	time.Sleep(time.Millisecond)
+	postWebhook(t, collector, testResponse("1", "Paris", "200"))
+	time.Sleep(time.Millisecond)
+	postWebhook(t, collector, testResponse("2", "London", "300"))
+
+	results, _ := collector.history.results("1", 0)
+	if len(results) != 1 || results[0].NodeName != "Paris" {
+		t.Errorf("expected the history of the evicted series to be dropped, got %+v", results)
+	}
+
+	collector.store.list(time.Now().Add(2 * time.Minute))
+	if tests := collector.history.testSummaries(); len(tests) != 0 {
+		t.Errorf("expected the history of expired series to be dropped, got %+v", tests)
+	}
+}
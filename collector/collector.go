@@ -15,10 +15,20 @@
 package collector
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/prometheus/client_golang/prometheus"
@@ -26,103 +36,142 @@ import (
 
 const (
 	// Metric names
-	UpMetric                   = "catchpoint_up"
-	TotalTimeMetric            = "catchpoint_total_time"
-	ConnectTimeMetric          = "catchpoint_connect_time"
-	DNSTimeMetric              = "catchpoint_dns_time"
-	ContentLoadTimeMetric      = "catchpoint_content_load_time"
-	LoadTimeMetric             = "catchpoint_load_time"
-	RedirectTimeMetric         = "catchpoint_redirect_time"
-	SSLTimeMetric              = "catchpoint_ssl_time"
-	WaitTimeMetric             = "catchpoint_wait_time"
-	ClientTimeMetric           = "catchpoint_client_time"
-	DocumentCompleteTimeMetric = "catchpoint_document_complete_time"
-	RenderStartTimeMetric      = "catchpoint_render_start_time"
-	ResponseContentSizeMetric  = "catchpoint_response_content_size"
-	ResponseHeadersSizeMetric  = "catchpoint_response_headers_size"
-	TotalContentSizeMetric     = "catchpoint_total_content_size"
-	TotalHeadersSizeMetric     = "catchpoint_total_headers_size"
-	AnyErrorMetric             = "catchpoint_any_error"
-	ConnectionErrorMetric      = "catchpoint_connection_error"
-	DNSErrorMetric             = "catchpoint_dns_error"
-	LoadErrorMetric            = "catchpoint_load_error"
-	TimeoutErrorMetric         = "catchpoint_timeout_error"
-	TransactionErrorMetric     = "catchpoint_transaction_error"
-	ErrorObjectsLoadedMetric   = "catchpoint_error_objects_loaded"
-	ImageContentTypeMetric     = "catchpoint_image_content_type"
-	ScriptContentTypeMetric    = "catchpoint_script_content_type"
-	HTMLContentTypeMetric      = "catchpoint_html_content_type"
-	CSSContentTypeMetric       = "catchpoint_css_content_type"
-	FontContentTypeMetric      = "catchpoint_font_content_type"
-	MediaContentTypeMetric     = "catchpoint_media_content_type"
-	XMLContentTypeMetric       = "catchpoint_xml_content_type"
-	OtherContentTypeMetric     = "catchpoint_other_content_type"
-	ConnectionsCountMetric     = "catchpoint_connections_count"
-	HostsCountMetric           = "catchpoint_hosts_count"
-	FailedRequestsCountMetric  = "catchpoint_failed_requests_count"
-	RequestsCountMetric        = "catchpoint_requests_count"
-	RedirectionsCountMetric    = "catchpoint_redirections_count"
-	CachedCountMetric          = "catchpoint_cached_count"
-	ImageCountMetric           = "catchpoint_image_count"
-	ScriptCountMetric          = "catchpoint_script_count"
-	HTMLCountMetric            = "catchpoint_html_count"
-	CSSCountMetric             = "catchpoint_css_count"
-	FontCountMetric            = "catchpoint_font_count"
-	XMLCountMetric             = "catchpoint_xml_count"
-	MediaCountMetric           = "catchpoint_media_count"
-	TracepointsCountMetric     = "catchpoint_tracepoints_count"
+	UpMetric                     = "catchpoint_up"
+	TotalTimeMetric              = "catchpoint_total_time"
+	ConnectTimeMetric            = "catchpoint_connect_time"
+	DNSTimeMetric                = "catchpoint_dns_time"
+	ContentLoadTimeMetric        = "catchpoint_content_load_time"
+	LoadTimeMetric               = "catchpoint_load_time"
+	RedirectTimeMetric           = "catchpoint_redirect_time"
+	SSLTimeMetric                = "catchpoint_ssl_time"
+	WaitTimeMetric               = "catchpoint_wait_time"
+	ClientTimeMetric             = "catchpoint_client_time"
+	DocumentCompleteTimeMetric   = "catchpoint_document_complete_time"
+	RenderStartTimeMetric        = "catchpoint_render_start_time"
+	FirstContentfulPaintMetric   = "catchpoint_first_contentful_paint_time"
+	LargestContentfulPaintMetric = "catchpoint_largest_contentful_paint_time"
+	CumulativeLayoutShiftMetric  = "catchpoint_cumulative_layout_shift"
+	TotalBlockingTimeMetric      = "catchpoint_total_blocking_time"
+	TimeToInteractiveMetric      = "catchpoint_time_to_interactive"
+	SpeedIndexMetric             = "catchpoint_speed_index"
+	ResponseContentSizeMetric    = "catchpoint_response_content_size"
+	ResponseHeadersSizeMetric    = "catchpoint_response_headers_size"
+	TotalContentSizeMetric       = "catchpoint_total_content_size"
+	TotalHeadersSizeMetric       = "catchpoint_total_headers_size"
+	AnyErrorMetric               = "catchpoint_any_error"
+	ConnectionErrorMetric        = "catchpoint_connection_error"
+	DNSErrorMetric               = "catchpoint_dns_error"
+	LoadErrorMetric              = "catchpoint_load_error"
+	TimeoutErrorMetric           = "catchpoint_timeout_error"
+	TransactionErrorMetric       = "catchpoint_transaction_error"
+	ErrorObjectsLoadedMetric     = "catchpoint_error_objects_loaded"
+	ImageContentTypeMetric       = "catchpoint_image_content_type"
+	ScriptContentTypeMetric      = "catchpoint_script_content_type"
+	HTMLContentTypeMetric        = "catchpoint_html_content_type"
+	CSSContentTypeMetric         = "catchpoint_css_content_type"
+	FontContentTypeMetric        = "catchpoint_font_content_type"
+	MediaContentTypeMetric       = "catchpoint_media_content_type"
+	XMLContentTypeMetric         = "catchpoint_xml_content_type"
+	OtherContentTypeMetric       = "catchpoint_other_content_type"
+	ConnectionsCountMetric       = "catchpoint_connections_count"
+	HostsCountMetric             = "catchpoint_hosts_count"
+	FailedRequestsCountMetric    = "catchpoint_failed_requests_count"
+	RequestsCountMetric          = "catchpoint_requests_count"
+	RedirectionsCountMetric      = "catchpoint_redirections_count"
+	CachedCountMetric            = "catchpoint_cached_count"
+	ImageCountMetric             = "catchpoint_image_count"
+	ScriptCountMetric            = "catchpoint_script_count"
+	HTMLCountMetric              = "catchpoint_html_count"
+	CSSCountMetric               = "catchpoint_css_count"
+	FontCountMetric              = "catchpoint_font_count"
+	XMLCountMetric               = "catchpoint_xml_count"
+	MediaCountMetric             = "catchpoint_media_count"
+	TracepointsCountMetric       = "catchpoint_tracepoints_count"
+	WebhooksReceivedMetric       = "catchpoint_webhooks_received_total"
+	WebhookFilteredMetric        = "catchpoint_webhook_filtered_total"
+	NodeNameParseErrorsMetric    = "catchpoint_node_name_parse_errors_total"
+	NodeInfoMetric               = "catchpoint_node_info"
+	SeriesLimitHitsMetric        = "catchpoint_series_limit_hits_total"
+	WebhookOutOfOrderMetric      = "catchpoint_webhook_out_of_order_total"
+	WebhookDuplicatesMetric      = "catchpoint_webhook_duplicates_total"
+	WebhookThrottledMetric       = "catchpoint_webhook_throttled_total"
+	WebhookSourceRejectedMetric  = "catchpoint_webhook_source_rejected_total"
 
 	// Metric descriptions
-	UpDesc                   = "Catchpoint exporter is up and running."
-	TotalTimeDesc            = "Total time it took to load the webpage in milliseconds."
-	ConnectTimeDesc          = "Time taken to connect to the URL in milliseconds."
-	DNSTimeDesc              = "Time taken to resolve the domain name in milliseconds."
-	ContentLoadTimeDesc      = "Time taken to load content in milliseconds."
-	LoadTimeDesc             = "Time taken to load the first and last byte of the primary URL in milliseconds."
-	RedirectTimeDesc         = "Time taken for HTTP redirects in milliseconds."
-	SSLTimeDesc              = "Time taken to establish SSL handshake in milliseconds."
-	WaitTimeDesc             = "Time from successful connection to receiving the first byte in milliseconds."
-	ClientTimeDesc           = "Client processing time in milliseconds."
-	DocumentCompleteTimeDesc = "Time taken for the browser to fully render the page after all resources are downloaded in milliseconds."
-	RenderStartTimeDesc      = "Time taken to start rendering the webpage in milliseconds."
-	ResponseContentSizeDesc  = "Size of the HTTP response content in bytes."
-	ResponseHeadersSizeDesc  = "Size of the HTTP response headers in bytes."
-	TotalContentSizeDesc     = "Total size of the HTTP response content and headers in bytes."
-	TotalHeadersSizeDesc     = "Total size of the HTTP response headers in bytes."
-	AnyErrorDesc             = "Indicates if any error occurred during the test."
-	ConnectionErrorDesc      = "Indicates if a connection error occurred during the test."
-	DNSErrorDesc             = "Indicates if a DNS error occurred during the test."
-	LoadErrorDesc            = "Indicates if a load error occurred during the test."
-	TimeoutErrorDesc         = "Indicates if a timeout error occurred during the test."
-	TransactionErrorDesc     = "Indicates if a transaction error occurred during the test."
-	ErrorObjectsLoadedDesc   = "Indicates if error objects were loaded during the test."
-	ImageContentTypeDesc     = "Size of image content loaded during the test in bytes."
-	ScriptContentTypeDesc    = "Size of script content loaded during the test in bytes."
-	HTMLContentTypeDesc      = "Size of HTML content loaded during the test in bytes."
-	CSSContentTypeDesc       = "Size of CSS content loaded during the test in bytes."
-	FontContentTypeDesc      = "Size of font content loaded during the test in bytes."
-	MediaContentTypeDesc     = "Size of media content loaded during the test in bytes."
-	XMLContentTypeDesc       = "Size of XML content loaded during the test in bytes."
-	OtherContentTypeDesc     = "Size of other content loaded during the test in bytes."
-	ConnectionsCountDesc     = "Total number of connections made during the test."
-	HostsCountDesc           = "Total number of hosts contacted during the test."
-	FailedRequestsCountDesc  = "Number of failed requests during the test."
-	RequestsCountDesc        = "Number of requests made during the test."
-	RedirectionsCountDesc    = "Number of HTTP redirections encountered during the test."
-	CachedCountDesc          = "Number of cached elements accessed during the test."
-	ImageCountDesc           = "Number of image elements loaded during the test."
-	ScriptCountDesc          = "Number of script elements loaded during the test."
-	HTMLCountDesc            = "Number of HTML documents loaded during the test."
-	CSSCountDesc             = "Number of CSS documents loaded during the test."
-	FontCountDesc            = "Number of font resources loaded during the test."
-	XMLCountDesc             = "Number of XML documents loaded during the test."
-	MediaCountDesc           = "Number of media elements loaded during the test."
-	TracepointsCountDesc     = "Number of tracepoints hit during the test."
+	UpDesc                     = "Catchpoint exporter is up and running."
+	TotalTimeDesc              = "Total time it took to load the webpage in milliseconds."
+	ConnectTimeDesc            = "Time taken to connect to the URL in milliseconds."
+	DNSTimeDesc                = "Time taken to resolve the domain name in milliseconds."
+	ContentLoadTimeDesc        = "Time taken to load content in milliseconds."
+	LoadTimeDesc               = "Time taken to load the first and last byte of the primary URL in milliseconds."
+	RedirectTimeDesc           = "Time taken for HTTP redirects in milliseconds."
+	SSLTimeDesc                = "Time taken to establish SSL handshake in milliseconds."
+	WaitTimeDesc               = "Time from successful connection to receiving the first byte in milliseconds."
+	ClientTimeDesc             = "Client processing time in milliseconds."
+	DocumentCompleteTimeDesc   = "Time taken for the browser to fully render the page after all resources are downloaded in milliseconds."
+	RenderStartTimeDesc        = "Time taken to start rendering the webpage in milliseconds."
+	FirstContentfulPaintDesc   = "Time until the browser rendered the first text or image of the webpage in milliseconds."
+	LargestContentfulPaintDesc = "Time until the browser rendered the largest text or image of the webpage in milliseconds."
+	CumulativeLayoutShiftDesc  = "Cumulative Layout Shift score of the webpage, a unitless measure of unexpected layout shifts."
+	TotalBlockingTimeDesc      = "Total time the main thread was blocked long enough to prevent input responsiveness in milliseconds."
+	TimeToInteractiveDesc      = "Time until the webpage became reliably interactive in milliseconds."
+	SpeedIndexDesc             = "Speed Index of the webpage, the average time at which visible parts of the page are displayed, in milliseconds."
+	ResponseContentSizeDesc    = "Size of the HTTP response content in bytes."
+	ResponseHeadersSizeDesc    = "Size of the HTTP response headers in bytes."
+	TotalContentSizeDesc       = "Total size of the HTTP response content and headers in bytes."
+	TotalHeadersSizeDesc       = "Total size of the HTTP response headers in bytes."
+	AnyErrorDesc               = "Indicates if any error occurred during the test."
+	ConnectionErrorDesc        = "Indicates if a connection error occurred during the test."
+	DNSErrorDesc               = "Indicates if a DNS error occurred during the test."
+	LoadErrorDesc              = "Indicates if a load error occurred during the test."
+	TimeoutErrorDesc           = "Indicates if a timeout error occurred during the test."
+	TransactionErrorDesc       = "Indicates if a transaction error occurred during the test."
+	ErrorObjectsLoadedDesc     = "Indicates if error objects were loaded during the test."
+	ImageContentTypeDesc       = "Size of image content loaded during the test in bytes."
+	ScriptContentTypeDesc      = "Size of script content loaded during the test in bytes."
+	HTMLContentTypeDesc        = "Size of HTML content loaded during the test in bytes."
+	CSSContentTypeDesc         = "Size of CSS content loaded during the test in bytes."
+	FontContentTypeDesc        = "Size of font content loaded during the test in bytes."
+	MediaContentTypeDesc       = "Size of media content loaded during the test in bytes."
+	XMLContentTypeDesc         = "Size of XML content loaded during the test in bytes."
+	OtherContentTypeDesc       = "Size of other content loaded during the test in bytes."
+	ConnectionsCountDesc       = "Total number of connections made during the test."
+	HostsCountDesc             = "Total number of hosts contacted during the test."
+	FailedRequestsCountDesc    = "Number of failed requests during the test."
+	RequestsCountDesc          = "Number of requests made during the test."
+	RedirectionsCountDesc      = "Number of HTTP redirections encountered during the test."
+	CachedCountDesc            = "Number of cached elements accessed during the test."
+	ImageCountDesc             = "Number of image elements loaded during the test."
+	ScriptCountDesc            = "Number of script elements loaded during the test."
+	HTMLCountDesc              = "Number of HTML documents loaded during the test."
+	CSSCountDesc               = "Number of CSS documents loaded during the test."
+	FontCountDesc              = "Number of font resources loaded during the test."
+	XMLCountDesc               = "Number of XML documents loaded during the test."
+	MediaCountDesc             = "Number of media elements loaded during the test."
+	TracepointsCountDesc       = "Number of tracepoints hit during the test."
+	WebhooksReceivedDesc       = "Number of webhooks received by the exporter by outcome."
+	WebhookFilteredDesc        = "Number of results dropped by filter rules by rule."
+	NodeNameParseErrorsDesc    = "Number of results whose node name could not be parsed into city, country and ISP."
+	NodeInfoDesc               = "Current name of a Catchpoint node, with value 1."
+	SeriesLimitHitsDesc        = "Number of times a cardinality limit was hit by limit."
+	WebhookOutOfOrderDesc      = "Number of results ignored because a newer result of the series was stored."
+	WebhookDuplicatesDesc      = "Number of results ignored because they were identical to the stored result."
+	WebhookThrottledDesc       = "Number of webhooks rejected with 429 because their source exceeded the rate limit."
+	WebhookSourceRejectedDesc  = "Number of webhooks rejected with 403 because their source IP is not allowed."
 )
 
+var (
+	errClientNotAllowed = errors.New("client ID not allowed")
+)
+
+// webhookRetryAfter is the Retry-After value, in seconds, of 429 and 503
+// webhook responses.
+const webhookRetryAfter = "5"
+
 // Labels
 var (
 	testIDLabel        = "test_id"
+	nodeIDLabel        = "node_id"
 	nodeNameLabel      = "node_name"
 	testNameLabel      = "test_name"
 	clientIDLabel      = "client_id"
@@ -130,58 +179,104 @@ var (
 	divisionIDLabel    = "division_id"
 	monitorTypeIDLabel = "monitor_type_id"
 	typeIDLabel        = "type_id"
+	outcomeLabel       = "outcome"
+	ruleLabel          = "rule"
+	limitLabel         = "limit"
 )
 
+// relabelDropRule is the rule label of results dropped by a keep or drop
+// relabel config.
+const relabelDropRule = "relabel"
+
 type Collector struct {
-	latestResponse *Response
-	logger         log.Logger
-	up             prometheus.Gauge
-	cfg            *Config
-
-	totalTimeMetric            *prometheus.Desc
-	connectTimeMetric          *prometheus.Desc
-	dnsTimeMetric              *prometheus.Desc
-	contentLoadTimeMetric      *prometheus.Desc
-	loadTimeMetric             *prometheus.Desc
-	redirectTimeMetric         *prometheus.Desc
-	sslTimeMetric              *prometheus.Desc
-	waitTimeMetric             *prometheus.Desc
-	clientTimeMetric           *prometheus.Desc
-	documentCompleteTimeMetric *prometheus.Desc
-	renderStartTimeMetric      *prometheus.Desc
-	responseContentSizeMetric  *prometheus.Desc
-	responseHeadersSizeMetric  *prometheus.Desc
-	totalContentSizeMetric     *prometheus.Desc
-	totalHeadersSizeMetric     *prometheus.Desc
-	anyErrorMetric             *prometheus.Desc
-	connectionErrorMetric      *prometheus.Desc
-	dnsErrorMetric             *prometheus.Desc
-	loadErrorMetric            *prometheus.Desc
-	timeoutErrorMetric         *prometheus.Desc
-	transactionErrorMetric     *prometheus.Desc
-	errorObjectsLoadedMetric   *prometheus.Desc
-	imageContentTypeMetric     *prometheus.Desc
-	scriptContentTypeMetric    *prometheus.Desc
-	htmlContentTypeMetric      *prometheus.Desc
-	cssContentTypeMetric       *prometheus.Desc
-	fontContentTypeMetric      *prometheus.Desc
-	mediaContentTypeMetric     *prometheus.Desc
-	xmlContentTypeMetric       *prometheus.Desc
-	otherContentTypeMetric     *prometheus.Desc
-	connectionsCountMetric     *prometheus.Desc
-	hostsCountMetric           *prometheus.Desc
-	failedRequestsCountMetric  *prometheus.Desc
-	requestsCountMetric        *prometheus.Desc
-	redirectionsCountMetric    *prometheus.Desc
-	cachedCountMetric          *prometheus.Desc
-	imageCountMetric           *prometheus.Desc
-	scriptCountMetric          *prometheus.Desc
-	htmlCountMetric            *prometheus.Desc
-	cssCountMetric             *prometheus.Desc
-	fontCountMetric            *prometheus.Desc
-	xmlCountMetric             *prometheus.Desc
-	mediaCountMetric           *prometheus.Desc
-	tracepointsCountMetric     *prometheus.Desc
+	store        *seriesStore
+	history      *history
+	alerts       *alertStore
+	stream       *streamBroker
+	journal      *Journal
+	idempotency  *idempotencyCache
+	limiter      *rateLimiter
+	sources      atomic.Pointer[SourcePolicy]
+	queue        *ingestQueue
+	replicator   *Replicator
+	alertmanager *AlertmanagerNotifier
+	logger       log.Logger
+	up           prometheus.Gauge
+	cfg          *Config
+
+	webhooksAccepted atomic.Uint64
+	webhooksRejected atomic.Uint64
+	webhooksFiltered map[string]*atomic.Uint64
+	nodeNameErrors   atomic.Uint64
+	limitHits        map[string]*atomic.Uint64
+	outOfOrder       atomic.Uint64
+	draining         atomic.Bool
+	duplicates       atomic.Uint64
+	throttled        atomic.Uint64
+	sourceRejected   atomic.Uint64
+
+	totalTimeMetric              *seriesMetric
+	connectTimeMetric            *seriesMetric
+	dnsTimeMetric                *seriesMetric
+	contentLoadTimeMetric        *seriesMetric
+	loadTimeMetric               *seriesMetric
+	redirectTimeMetric           *seriesMetric
+	sslTimeMetric                *seriesMetric
+	waitTimeMetric               *seriesMetric
+	clientTimeMetric             *seriesMetric
+	documentCompleteTimeMetric   *seriesMetric
+	renderStartTimeMetric        *seriesMetric
+	firstContentfulPaintMetric   *seriesMetric
+	largestContentfulPaintMetric *seriesMetric
+	cumulativeLayoutShiftMetric  *seriesMetric
+	totalBlockingTimeMetric      *seriesMetric
+	timeToInteractiveMetric      *seriesMetric
+	speedIndexMetric             *seriesMetric
+	responseContentSizeMetric    *seriesMetric
+	responseHeadersSizeMetric    *seriesMetric
+	totalContentSizeMetric       *seriesMetric
+	totalHeadersSizeMetric       *seriesMetric
+	anyErrorMetric               *seriesMetric
+	connectionErrorMetric        *seriesMetric
+	dnsErrorMetric               *seriesMetric
+	loadErrorMetric              *seriesMetric
+	timeoutErrorMetric           *seriesMetric
+	transactionErrorMetric       *seriesMetric
+	errorObjectsLoadedMetric     *seriesMetric
+	imageContentTypeMetric       *seriesMetric
+	scriptContentTypeMetric      *seriesMetric
+	htmlContentTypeMetric        *seriesMetric
+	cssContentTypeMetric         *seriesMetric
+	fontContentTypeMetric        *seriesMetric
+	mediaContentTypeMetric       *seriesMetric
+	xmlContentTypeMetric         *seriesMetric
+	otherContentTypeMetric       *seriesMetric
+	connectionsCountMetric       *seriesMetric
+	hostsCountMetric             *seriesMetric
+	failedRequestsCountMetric    *seriesMetric
+	requestsCountMetric          *seriesMetric
+	redirectionsCountMetric      *seriesMetric
+	cachedCountMetric            *seriesMetric
+	imageCountMetric             *seriesMetric
+	scriptCountMetric            *seriesMetric
+	htmlCountMetric              *seriesMetric
+	cssCountMetric               *seriesMetric
+	fontCountMetric              *seriesMetric
+	xmlCountMetric               *seriesMetric
+	mediaCountMetric             *seriesMetric
+	tracepointsCountMetric       *seriesMetric
+	steps                        *stepMetrics
+	hosts                        *hostMetrics
+	testTypes                    *testTypeMetrics
+	webhooksReceivedMetric       *prometheus.Desc
+	webhookFilteredMetric        *prometheus.Desc
+	nodeNameErrorsMetric         *prometheus.Desc
+	nodeInfoMetric               *prometheus.Desc
+	limitHitsMetric              *prometheus.Desc
+	outOfOrderMetric             *prometheus.Desc
+	duplicatesMetric             *prometheus.Desc
+	throttledMetric              *prometheus.Desc
+	sourceRejectedMetric         *prometheus.Desc
 }
 
 func NewCollector(logger log.Logger, cfg *Config) *Collector {
@@ -191,378 +286,658 @@ func NewCollector(logger log.Logger, cfg *Config) *Collector {
 	}
 
 	upMetric := prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: UpMetric,
-		Help: UpDesc,
+		Name:        UpMetric,
+		Help:        UpDesc,
+		ConstLabels: cfg.Labels,
 	})
 	upMetric.Set(1) // Initially set to 1, indicating "up"
 
-	return &Collector{
-		logger: logger,
-		cfg:    cfg,
-		up:     upMetric,
-		totalTimeMetric: prometheus.NewDesc(
-			TotalTimeMetric,
-			TotalTimeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		connectTimeMetric: prometheus.NewDesc(
-			ConnectTimeMetric,
-			ConnectTimeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		dnsTimeMetric: prometheus.NewDesc(
-			DNSTimeMetric,
-			DNSTimeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		contentLoadTimeMetric: prometheus.NewDesc(
-			ContentLoadTimeMetric,
-			ContentLoadTimeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		loadTimeMetric: prometheus.NewDesc(
-			LoadTimeMetric,
-			LoadTimeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		redirectTimeMetric: prometheus.NewDesc(
-			RedirectTimeMetric,
-			RedirectTimeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		sslTimeMetric: prometheus.NewDesc(
-			SSLTimeMetric,
-			SSLTimeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		waitTimeMetric: prometheus.NewDesc(
-			WaitTimeMetric,
-			WaitTimeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		clientTimeMetric: prometheus.NewDesc(
-			ClientTimeMetric,
-			ClientTimeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		documentCompleteTimeMetric: prometheus.NewDesc(
-			DocumentCompleteTimeMetric,
-			DocumentCompleteTimeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		renderStartTimeMetric: prometheus.NewDesc(
-			RenderStartTimeMetric,
-			RenderStartTimeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		responseContentSizeMetric: prometheus.NewDesc(
-			ResponseContentSizeMetric,
-			ResponseContentSizeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		responseHeadersSizeMetric: prometheus.NewDesc(
-			ResponseHeadersSizeMetric,
-			ResponseHeadersSizeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		totalContentSizeMetric: prometheus.NewDesc(
-			TotalContentSizeMetric,
-			TotalContentSizeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		totalHeadersSizeMetric: prometheus.NewDesc(
-			TotalHeadersSizeMetric,
-			TotalHeadersSizeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		anyErrorMetric: prometheus.NewDesc(
-			AnyErrorMetric,
-			AnyErrorDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		connectionErrorMetric: prometheus.NewDesc(
-			ConnectionErrorMetric,
-			ConnectionErrorDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		dnsErrorMetric: prometheus.NewDesc(
-			DNSErrorMetric,
-			DNSErrorDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		loadErrorMetric: prometheus.NewDesc(
-			LoadErrorMetric,
-			LoadErrorDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		timeoutErrorMetric: prometheus.NewDesc(
-			TimeoutErrorMetric,
-			TimeoutErrorDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		transactionErrorMetric: prometheus.NewDesc(
-			TransactionErrorMetric,
-			TransactionErrorDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		errorObjectsLoadedMetric: prometheus.NewDesc(
-			ErrorObjectsLoadedMetric,
-			ErrorObjectsLoadedDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		imageContentTypeMetric: prometheus.NewDesc(
-			ImageContentTypeMetric,
-			ImageContentTypeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		scriptContentTypeMetric: prometheus.NewDesc(
-			ScriptContentTypeMetric,
-			ScriptContentTypeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		htmlContentTypeMetric: prometheus.NewDesc(
-			HTMLContentTypeMetric,
-			HTMLContentTypeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		cssContentTypeMetric: prometheus.NewDesc(
-			CSSContentTypeMetric,
-			CSSContentTypeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		fontContentTypeMetric: prometheus.NewDesc(
-			FontContentTypeMetric,
-			FontContentTypeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		mediaContentTypeMetric: prometheus.NewDesc(
-			MediaContentTypeMetric,
-			MediaContentTypeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		xmlContentTypeMetric: prometheus.NewDesc(
-			XMLContentTypeMetric,
-			XMLContentTypeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		otherContentTypeMetric: prometheus.NewDesc(
-			OtherContentTypeMetric,
-			OtherContentTypeDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		connectionsCountMetric: prometheus.NewDesc(
-			ConnectionsCountMetric,
-			ConnectionsCountDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		hostsCountMetric: prometheus.NewDesc(
-			HostsCountMetric,
-			HostsCountDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		failedRequestsCountMetric: prometheus.NewDesc(
-			FailedRequestsCountMetric,
-			FailedRequestsCountDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		requestsCountMetric: prometheus.NewDesc(
-			RequestsCountMetric,
-			RequestsCountDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		redirectionsCountMetric: prometheus.NewDesc(
-			RedirectionsCountMetric,
-			RedirectionsCountDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
-		),
-		cachedCountMetric: prometheus.NewDesc(
-			CachedCountMetric,
-			CachedCountDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
+	// Only exclude rules drop results by their own name; results matching no
+	// include rule are counted under noIncludeMatchRule.
+	filtered := make(map[string]*atomic.Uint64)
+	for _, rule := range cfg.Filters {
+		switch rule.Action {
+		case FilterExclude:
+			filtered[rule.Name] = new(atomic.Uint64)
+		case FilterInclude:
+			filtered[noIncludeMatchRule] = new(atomic.Uint64)
+		}
+	}
+	for _, rc := range cfg.RelabelConfigs {
+		if rc.action() == RelabelKeep || rc.action() == RelabelDrop {
+			filtered[relabelDropRule] = new(atomic.Uint64)
+		}
+	}
+
+	limitHits := make(map[string]*atomic.Uint64)
+	for limit, value := range map[string]int{
+		limitSeries:           cfg.SeriesLimit,
+		limitSeriesPerTest:    cfg.SeriesLimitPerTest,
+		limitLabelValueLength: cfg.LabelValueLengthLimit,
+		limitHostsPerResult:   cfg.HostsLimit,
+		limitStepsPerResult:   cfg.StepsLimit,
+	} {
+		if value > 0 {
+			limitHits[limit] = new(atomic.Uint64)
+		}
+	}
+	limits := seriesLimits{
+		total:   cfg.SeriesLimit,
+		perTest: cfg.SeriesLimitPerTest,
+		evict:   cfg.SeriesLimitPolicy == LimitPolicyEvict,
+	}
+
+	var idempotency *idempotencyCache
+	if cfg.IdempotencyTTL > 0 {
+		idempotency = newIdempotencyCache(cfg.IdempotencyTTL, idempotencyCacheSize)
+	}
+	var limiter *rateLimiter
+	if cfg.WebhookRateLimit > 0 {
+		limiter = newRateLimiter(cfg.WebhookRateLimit, cfg.WebhookRateBurst)
+	}
+
+	c := &Collector{
+		idempotency:      idempotency,
+		alerts:           newAlertStore(cfg.Labels, cfg.SeriesTTL, limits, cfg.LabelValueLengthLimit),
+		limiter:          limiter,
+		webhooksFiltered: filtered,
+		limitHits:        limitHits,
+
+		logger:                       logger,
+		cfg:                          cfg,
+		up:                           upMetric,
+		store:                        newSeriesStore(cfg.SeriesTTL, limits),
+		history:                      newHistory(cfg.HistorySize, cfg.SeriesLimit),
+		stream:                       newStreamBroker(),
+		totalTimeMetric:              newSeriesMetric(TotalTimeMetric, TotalTimeDesc, cfg.Labels),
+		connectTimeMetric:            newSeriesMetric(ConnectTimeMetric, ConnectTimeDesc, cfg.Labels),
+		dnsTimeMetric:                newSeriesMetric(DNSTimeMetric, DNSTimeDesc, cfg.Labels),
+		contentLoadTimeMetric:        newSeriesMetric(ContentLoadTimeMetric, ContentLoadTimeDesc, cfg.Labels),
+		loadTimeMetric:               newSeriesMetric(LoadTimeMetric, LoadTimeDesc, cfg.Labels),
+		redirectTimeMetric:           newSeriesMetric(RedirectTimeMetric, RedirectTimeDesc, cfg.Labels),
+		sslTimeMetric:                newSeriesMetric(SSLTimeMetric, SSLTimeDesc, cfg.Labels),
+		waitTimeMetric:               newSeriesMetric(WaitTimeMetric, WaitTimeDesc, cfg.Labels),
+		clientTimeMetric:             newSeriesMetric(ClientTimeMetric, ClientTimeDesc, cfg.Labels),
+		documentCompleteTimeMetric:   newSeriesMetric(DocumentCompleteTimeMetric, DocumentCompleteTimeDesc, cfg.Labels),
+		renderStartTimeMetric:        newSeriesMetric(RenderStartTimeMetric, RenderStartTimeDesc, cfg.Labels),
+		firstContentfulPaintMetric:   newSeriesMetric(FirstContentfulPaintMetric, FirstContentfulPaintDesc, cfg.Labels),
+		largestContentfulPaintMetric: newSeriesMetric(LargestContentfulPaintMetric, LargestContentfulPaintDesc, cfg.Labels),
+		cumulativeLayoutShiftMetric:  newSeriesMetric(CumulativeLayoutShiftMetric, CumulativeLayoutShiftDesc, cfg.Labels),
+		totalBlockingTimeMetric:      newSeriesMetric(TotalBlockingTimeMetric, TotalBlockingTimeDesc, cfg.Labels),
+		timeToInteractiveMetric:      newSeriesMetric(TimeToInteractiveMetric, TimeToInteractiveDesc, cfg.Labels),
+		speedIndexMetric:             newSeriesMetric(SpeedIndexMetric, SpeedIndexDesc, cfg.Labels),
+		responseContentSizeMetric:    newSeriesMetric(ResponseContentSizeMetric, ResponseContentSizeDesc, cfg.Labels),
+		responseHeadersSizeMetric:    newSeriesMetric(ResponseHeadersSizeMetric, ResponseHeadersSizeDesc, cfg.Labels),
+		totalContentSizeMetric:       newSeriesMetric(TotalContentSizeMetric, TotalContentSizeDesc, cfg.Labels),
+		totalHeadersSizeMetric:       newSeriesMetric(TotalHeadersSizeMetric, TotalHeadersSizeDesc, cfg.Labels),
+		anyErrorMetric:               newSeriesMetric(AnyErrorMetric, AnyErrorDesc, cfg.Labels),
+		connectionErrorMetric:        newSeriesMetric(ConnectionErrorMetric, ConnectionErrorDesc, cfg.Labels),
+		dnsErrorMetric:               newSeriesMetric(DNSErrorMetric, DNSErrorDesc, cfg.Labels),
+		loadErrorMetric:              newSeriesMetric(LoadErrorMetric, LoadErrorDesc, cfg.Labels),
+		timeoutErrorMetric:           newSeriesMetric(TimeoutErrorMetric, TimeoutErrorDesc, cfg.Labels),
+		transactionErrorMetric:       newSeriesMetric(TransactionErrorMetric, TransactionErrorDesc, cfg.Labels),
+		errorObjectsLoadedMetric:     newSeriesMetric(ErrorObjectsLoadedMetric, ErrorObjectsLoadedDesc, cfg.Labels),
+		imageContentTypeMetric:       newSeriesMetric(ImageContentTypeMetric, ImageContentTypeDesc, cfg.Labels),
+		scriptContentTypeMetric:      newSeriesMetric(ScriptContentTypeMetric, ScriptContentTypeDesc, cfg.Labels),
+		htmlContentTypeMetric:        newSeriesMetric(HTMLContentTypeMetric, HTMLContentTypeDesc, cfg.Labels),
+		cssContentTypeMetric:         newSeriesMetric(CSSContentTypeMetric, CSSContentTypeDesc, cfg.Labels),
+		fontContentTypeMetric:        newSeriesMetric(FontContentTypeMetric, FontContentTypeDesc, cfg.Labels),
+		mediaContentTypeMetric:       newSeriesMetric(MediaContentTypeMetric, MediaContentTypeDesc, cfg.Labels),
+		xmlContentTypeMetric:         newSeriesMetric(XMLContentTypeMetric, XMLContentTypeDesc, cfg.Labels),
+		otherContentTypeMetric:       newSeriesMetric(OtherContentTypeMetric, OtherContentTypeDesc, cfg.Labels),
+		connectionsCountMetric:       newSeriesMetric(ConnectionsCountMetric, ConnectionsCountDesc, cfg.Labels),
+		hostsCountMetric:             newSeriesMetric(HostsCountMetric, HostsCountDesc, cfg.Labels),
+		failedRequestsCountMetric:    newSeriesMetric(FailedRequestsCountMetric, FailedRequestsCountDesc, cfg.Labels),
+		requestsCountMetric:          newSeriesMetric(RequestsCountMetric, RequestsCountDesc, cfg.Labels),
+		redirectionsCountMetric:      newSeriesMetric(RedirectionsCountMetric, RedirectionsCountDesc, cfg.Labels),
+		cachedCountMetric:            newSeriesMetric(CachedCountMetric, CachedCountDesc, cfg.Labels),
+		imageCountMetric:             newSeriesMetric(ImageCountMetric, ImageCountDesc, cfg.Labels),
+		scriptCountMetric:            newSeriesMetric(ScriptCountMetric, ScriptCountDesc, cfg.Labels),
+		htmlCountMetric:              newSeriesMetric(HTMLCountMetric, HTMLCountDesc, cfg.Labels),
+		cssCountMetric:               newSeriesMetric(CSSCountMetric, CSSCountDesc, cfg.Labels),
+		fontCountMetric:              newSeriesMetric(FontCountMetric, FontCountDesc, cfg.Labels),
+		xmlCountMetric:               newSeriesMetric(XMLCountMetric, XMLCountDesc, cfg.Labels),
+		mediaCountMetric:             newSeriesMetric(MediaCountMetric, MediaCountDesc, cfg.Labels),
+		tracepointsCountMetric:       newSeriesMetric(TracepointsCountMetric, TracepointsCountDesc, cfg.Labels),
+		steps:                        newStepMetrics(cfg.Labels),
+		hosts:                        newHostMetrics(cfg.Labels),
+		testTypes:                    newTestTypeMetrics(cfg.Labels),
+		webhooksReceivedMetric: prometheus.NewDesc(
+			WebhooksReceivedMetric,
+			WebhooksReceivedDesc,
+			[]string{outcomeLabel},
+			cfg.Labels,
 		),
-		imageCountMetric: prometheus.NewDesc(
-			ImageCountMetric,
-			ImageCountDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
+		webhookFilteredMetric: prometheus.NewDesc(
+			WebhookFilteredMetric,
+			WebhookFilteredDesc,
+			[]string{ruleLabel},
+			cfg.Labels,
 		),
-		scriptCountMetric: prometheus.NewDesc(
-			ScriptCountMetric,
-			ScriptCountDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
+		nodeNameErrorsMetric: prometheus.NewDesc(
+			NodeNameParseErrorsMetric,
+			NodeNameParseErrorsDesc,
 			nil,
+			cfg.Labels,
 		),
-		htmlCountMetric: prometheus.NewDesc(
-			HTMLCountMetric,
-			HTMLCountDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
+		nodeInfoMetric: prometheus.NewDesc(
+			NodeInfoMetric,
+			NodeInfoDesc,
+			[]string{nodeIDLabel, nodeNameLabel},
+			cfg.Labels,
 		),
-		cssCountMetric: prometheus.NewDesc(
-			CSSCountMetric,
-			CSSCountDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
-			nil,
+		limitHitsMetric: prometheus.NewDesc(
+			SeriesLimitHitsMetric,
+			SeriesLimitHitsDesc,
+			[]string{limitLabel},
+			cfg.Labels,
 		),
-		fontCountMetric: prometheus.NewDesc(
-			FontCountMetric,
-			FontCountDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
+		outOfOrderMetric: prometheus.NewDesc(
+			WebhookOutOfOrderMetric,
+			WebhookOutOfOrderDesc,
 			nil,
+			cfg.Labels,
 		),
-		xmlCountMetric: prometheus.NewDesc(
-			XMLCountMetric,
-			XMLCountDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
+		duplicatesMetric: prometheus.NewDesc(
+			WebhookDuplicatesMetric,
+			WebhookDuplicatesDesc,
 			nil,
+			cfg.Labels,
 		),
-		mediaCountMetric: prometheus.NewDesc(
-			MediaCountMetric,
-			MediaCountDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
+		throttledMetric: prometheus.NewDesc(
+			WebhookThrottledMetric,
+			WebhookThrottledDesc,
 			nil,
+			cfg.Labels,
 		),
-		tracepointsCountMetric: prometheus.NewDesc(
-			TracepointsCountMetric,
-			TracepointsCountDesc,
-			[]string{testIDLabel, nodeNameLabel, testNameLabel, clientIDLabel, asnLabel, divisionIDLabel, monitorTypeIDLabel, typeIDLabel},
+		sourceRejectedMetric: prometheus.NewDesc(
+			WebhookSourceRejectedMetric,
+			WebhookSourceRejectedDesc,
 			nil,
+			cfg.Labels,
 		),
 	}
+	c.alerts.onLimit = func(limit string) {
+		c.limitHits[limit].Add(1)
+	}
+	c.store.onDrop = func(series *Series) {
+		c.history.remove(&series.Response.TestDetails)
+	}
+	c.sources.Store(cfg.Sources)
+	if cfg.IngestWorkers > 0 {
+		c.queue = newIngestQueue(c, cfg.IngestWorkers, cfg.IngestQueueSize)
+	}
+	return c
 }
 
+// Describe sends no descriptors, which makes the collector unchecked: the label
+// names of a series depend on the relabel configs and are only known once a
+// result has been received.
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- c.up.Desc()
-	ch <- c.totalTimeMetric
-	ch <- c.connectTimeMetric
-	ch <- c.dnsTimeMetric
-	ch <- c.contentLoadTimeMetric
-	ch <- c.loadTimeMetric
-	ch <- c.redirectTimeMetric
-	ch <- c.sslTimeMetric
-	ch <- c.waitTimeMetric
-	ch <- c.clientTimeMetric
-	ch <- c.documentCompleteTimeMetric
-	ch <- c.renderStartTimeMetric
-	ch <- c.responseContentSizeMetric
-	ch <- c.responseHeadersSizeMetric
-	ch <- c.totalContentSizeMetric
-	ch <- c.totalHeadersSizeMetric
-	ch <- c.anyErrorMetric
-	ch <- c.connectionErrorMetric
-	ch <- c.dnsErrorMetric
-	ch <- c.loadErrorMetric
-	ch <- c.timeoutErrorMetric
-	ch <- c.transactionErrorMetric
-	ch <- c.errorObjectsLoadedMetric
-	ch <- c.imageContentTypeMetric
-	ch <- c.scriptContentTypeMetric
-	ch <- c.htmlContentTypeMetric
-	ch <- c.cssContentTypeMetric
-	ch <- c.fontContentTypeMetric
-	ch <- c.mediaContentTypeMetric
-	ch <- c.xmlContentTypeMetric
-	ch <- c.otherContentTypeMetric
-	ch <- c.connectionsCountMetric
-	ch <- c.hostsCountMetric
-	ch <- c.failedRequestsCountMetric
-	ch <- c.requestsCountMetric
-	ch <- c.redirectionsCountMetric
-	ch <- c.cachedCountMetric
-	ch <- c.imageCountMetric
-	ch <- c.scriptCountMetric
-	ch <- c.htmlCountMetric
-	ch <- c.cssCountMetric
-	ch <- c.fontCountMetric
-	ch <- c.xmlCountMetric
-	ch <- c.mediaCountMetric
-	ch <- c.tracepointsCountMetric
 }
 
 func (c *Collector) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 	if c == nil {
-		http.Error(w, "Collector instance is uninitialized", http.StatusInternalServerError)
+		writeAPIError(w, http.StatusInternalServerError, "collector instance is uninitialized")
+		return
+	}
+	body, ok := c.readWebhook(w, r)
+	if !ok {
 		return
 	}
 
-	var resp Response
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&resp); err != nil {
-		c.logger.Log("level", "error", "msg", "Failed to decode webhook response", "error", err)
-		http.Error(w, fmt.Sprintf("Error decoding response: %v", err), http.StatusBadRequest)
-		c.up.Set(0)
+	received := time.Now()
+	now, replicated := replicatedAt(r, c.cfg.ReplicationSecret, received)
+
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" || c.idempotency == nil {
+		code, resp := c.ingestWebhook(body, now, replicated)
+		writeWebhookResponse(w, code, resp)
 		return
 	}
 
+	// Idempotency keys expire relative to the local clock, not the receive
+	// time of a replicated webhook.
+	hash := sha256.Sum256(body)
+	if entry, ok := c.idempotency.begin(key, hash, received); ok {
+		switch {
+		case entry.hash != hash:
+			writeAPIError(w, http.StatusUnprocessableEntity, "idempotency key reused with a different payload")
+		case entry.pending:
+			w.Header().Set("Retry-After", webhookRetryAfter)
+			writeAPIError(w, http.StatusConflict, "a request with the same idempotency key is in progress")
+		default:
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			writeWebhookResponse(w, entry.code, entry.resp)
+		}
+		return
+	}
+	code, resp := c.ingestWebhook(body, now, replicated)
+	keep := code != http.StatusTooManyRequests && code < http.StatusInternalServerError
+	c.idempotency.finish(key, code, resp, keep, time.Now())
+	writeWebhookResponse(w, code, resp)
+}
+
+// readWebhook applies the checks shared by all webhook endpoints and returns
+// the decoded body. If a check fails, it writes the error response and
+// returns false.
+func (c *Collector) readWebhook(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return nil, false
+	}
+	sources := c.sources.Load()
+	source := sources.clientIP(r)
+	if !sources.allows(source) {
+		c.sourceRejected.Add(1)
+		c.logger.Log("level", "warn", "msg", "Rejected webhook from disallowed source", "source", source, "remote_addr", r.RemoteAddr)
+		writeAPIError(w, http.StatusForbidden, "source not allowed")
+		return nil, false
+	}
+	if c.draining.Load() {
+		w.Header().Set("Retry-After", webhookRetryAfter)
+		writeAPIError(w, http.StatusServiceUnavailable, "not accepting webhooks")
+		return nil, false
+	}
+	// Throttle before authorization, so guessing the secret is throttled too.
+	if c.limiter != nil && !c.limiter.allow(source.String(), time.Now()) {
+		c.throttled.Add(1)
+		if c.cfg.VerboseLogging {
+			c.logger.Log("level", "warn", "msg", "Throttled webhook", "remote_addr", r.RemoteAddr)
+		}
+		w.Header().Set("Retry-After", webhookRetryAfter)
+		writeAPIError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return nil, false
+	}
+
+	if !c.authorized(r) {
+		c.logger.Log("level", "warn", "msg", "Rejected unauthorized webhook", "remote_addr", r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeAPIError(w, http.StatusUnauthorized, "unauthorized")
+		return nil, false
+	}
+	if !jsonContentType(r.Header.Get("Content-Type")) {
+		writeAPIError(w, http.StatusUnsupportedMediaType, "content type must be application/json")
+		return nil, false
+	}
+
+	reader := r.Body
+	if c.cfg.WebhookMaxBodySize > 0 {
+		reader = http.MaxBytesReader(w, r.Body, c.cfg.WebhookMaxBodySize)
+	}
+	decoded, err := decodeBody(reader, r.Header.Get("Content-Encoding"), c.cfg.WebhookMaxDecodedSize)
+	if errors.Is(err, errUnsupportedEncoding) {
+		writeAPIError(w, http.StatusUnsupportedMediaType, err.Error())
+		return nil, false
+	}
+	var body []byte
+	if err == nil {
+		body, err = io.ReadAll(decoded)
+		decoded.Close()
+	}
+	if err != nil {
+		c.logger.Log("level", "error", "msg", "Failed to read webhook body", "error", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) || errors.Is(err, errDecodedBodyTooLarge) {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		} else {
+			writeAPIError(w, http.StatusBadRequest, "failed to read request body")
+		}
+		c.reject(body, err, time.Now())
+		return nil, false
+	}
+	return body, true
+}
+
+// WebhookResult is the data of a successful webhook response.
+type WebhookResult struct {
+	Outcome string `json:"outcome"`
+}
+
+// ingestWebhook decodes body and processes it, or queues it for processing
+// when there are ingestion workers, and returns the response status and body.
+// Results that were accepted, queued, filtered or ignored as duplicate or out
+// of order are successful. Retrying only helps with 429 and 5xx responses.
+func (c *Collector) ingestWebhook(body []byte, now time.Time, replicated bool) (int, apiResponse) {
+	resp, err := c.decode(body, now)
+	switch {
+	case errors.Is(err, errClientNotAllowed):
+		return http.StatusForbidden, apiResponse{Status: apiStatusError, Error: err.Error()}
+	case err != nil:
+		return http.StatusBadRequest, apiResponse{Status: apiStatusError, Error: "invalid webhook payload"}
+	}
+
+	job := &ingestJob{resp: resp, body: body, receivedAt: now, replicated: replicated}
+	if c.queue != nil {
+		switch err := c.queue.enqueue(job); {
+		case errors.Is(err, errQueueFull):
+			return http.StatusTooManyRequests, apiResponse{Status: apiStatusError, Error: "ingestion queue is full"}
+		case errors.Is(err, errQueueClosed):
+			return http.StatusServiceUnavailable, apiResponse{Status: apiStatusError, Error: "shutting down"}
+		}
+		c.accept(job)
+		return http.StatusAccepted, apiResponse{Status: apiStatusSuccess, Data: WebhookResult{Outcome: OutcomeQueued}}
+	}
+	c.accept(job)
+	outcome := c.processJob(job)
+	return http.StatusOK, apiResponse{Status: apiStatusSuccess, Data: WebhookResult{Outcome: outcome}}
+}
+
+// accept counts a webhook that is about to be acknowledged and writes its body
+// to the journal, so that acknowledged webhooks survive a crash.
+func (c *Collector) accept(job *ingestJob) {
+	c.accepted(job.resp)
+	if c.journal != nil {
+		if err := c.journal.Append(job.receivedAt, job.body); err != nil {
+			c.logger.Log("level", "error", "msg", "Failed to write webhook to journal", "error", err)
+		}
+	}
+}
+
+// accepted counts a decoded webhook as accepted.
+func (c *Collector) accepted(resp *Response) {
+	c.webhooksAccepted.Add(1)
 	c.up.Set(1)
 	if c.cfg.VerboseLogging {
 		c.logger.Log("level", "info", "msg", "Webhook processed successfully", "testID", resp.TestDetails.TestId)
 	}
+}
+
+// processJob processes a decoded webhook and forwards its body to the peers.
+func (c *Collector) processJob(job *ingestJob) string {
+	outcome := c.process(job.resp, job.receivedAt)
+	if c.replicator != nil && !job.replicated {
+		c.replicator.Replicate(job.body, job.receivedAt)
+	}
+	return outcome
+}
+
+func writeWebhookResponse(w http.ResponseWriter, code int, resp apiResponse) {
+	if code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", webhookRetryAfter)
+	}
+	writeJSON(w, code, resp)
+}
+
+// SetSources replaces the source policy of the webhook handler. It is used to
+// reload the allowed source ranges without a restart.
+func (c *Collector) SetSources(sources *SourcePolicy) {
+	c.sources.Store(sources)
+}
+
+// Drain makes the webhook handler answer 503 so senders retry elsewhere or
+// later. It is called while the exporter restores its state and when it shuts
+// down.
+func (c *Collector) Drain() {
+	c.draining.Store(true)
+}
+
+// Resume makes the webhook handler accept webhooks again after Drain.
+func (c *Collector) Resume() {
+	c.draining.Store(false)
+}
+
+// Ingest decodes a webhook body and stores the result as received at
+// receivedAt. It is the ingestion path shared by HandleWebhook and journal replay.
+// It returns the outcome of an accepted body, one of OutcomeAccepted,
+// OutcomeFiltered, OutcomeDuplicate and OutcomeOutOfOrder, or the reason the
+// body was rejected.
+func (c *Collector) Ingest(body []byte, receivedAt time.Time) (string, error) {
+	resp, err := c.decode(body, receivedAt)
+	if err != nil {
+		return "", err
+	}
+	c.accepted(resp)
+	return c.process(resp, receivedAt), nil
+}
+
+// decode decodes and validates a webhook body. Rejected bodies are recorded
+// with the reason.
+func (c *Collector) decode(body []byte, receivedAt time.Time) (*Response, error) {
+	var resp Response
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if err := decoder.Decode(&resp); err != nil {
+		c.logger.Log("level", "error", "msg", "Failed to decode webhook response", "error", err)
+		c.reject(body, err, receivedAt)
+		return nil, err
+	}
+	if !c.clientAllowed(resp.TestDetails.ClientId) {
+		err := fmt.Errorf("%w: %q", errClientNotAllowed, resp.TestDetails.ClientId)
+		c.logger.Log("level", "warn", "msg", "Rejected webhook from disallowed client", "clientID", resp.TestDetails.ClientId)
+		c.reject(body, err, receivedAt)
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// process filters, labels and stores a decoded result and returns the
+// outcome.
+func (c *Collector) process(resp *Response, receivedAt time.Time) string {
+	if rule, drop := filterResult(c.cfg.Filters, &resp.TestDetails); drop {
+		c.webhooksFiltered[rule].Add(1)
+		if c.cfg.VerboseLogging {
+			c.logger.Log("level", "info", "msg", "Result dropped by filter", "testID", resp.TestDetails.TestId, "rule", rule)
+		}
+		c.stream.publish(StreamEvent{Time: receivedAt, Outcome: OutcomeFiltered, Error: "dropped by filter rule " + rule, Response: resp})
+		return OutcomeFiltered
+	}
+
+	if c.cfg.ParseNodeNames {
+		if _, ok := ParseNodeName(resp.TestDetails.NodeName); !ok {
+			c.nodeNameErrors.Add(1)
+			if c.cfg.VerboseLogging {
+				c.logger.Log("level", "warn", "msg", "Failed to parse node name", "nodeName", resp.TestDetails.NodeName)
+			}
+		}
+	}
+
+	labels, ok := c.seriesLabels(&resp.TestDetails)
+	if !ok {
+		c.webhooksFiltered[relabelDropRule].Add(1)
+		if c.cfg.VerboseLogging {
+			c.logger.Log("level", "info", "msg", "Result dropped by relabeling", "testID", resp.TestDetails.TestId)
+		}
+		c.stream.publish(StreamEvent{Time: receivedAt, Outcome: OutcomeFiltered, Error: "dropped by relabeling", Response: resp})
+		return OutcomeFiltered
+	}
+
+	limit, err := c.store.set(*resp, labels, receivedAt)
+	if limit != "" {
+		c.limitHits[limit].Add(1)
+	}
+	switch {
+	case errors.Is(err, errSeriesLimit):
+		// Rejections are counted in catchpoint_series_limit_hits_total; logging
+		// each one would flood the log when the limit is hit.
+		if c.cfg.VerboseLogging {
+			c.logger.Log("level", "warn", "msg", "Result dropped by series limit", "testID", resp.TestDetails.TestId, "nodeID", resp.TestDetails.NodeId, "limit", limit)
+		}
+		c.stream.publish(StreamEvent{Time: receivedAt, Outcome: OutcomeFiltered, Error: "dropped by series limit " + limit, Response: resp})
+		return OutcomeFiltered
+	case errors.Is(err, errDuplicate):
+		c.duplicates.Add(1)
+		if c.cfg.VerboseLogging {
+			c.logger.Log("level", "info", "msg", "Ignored duplicate result", "testID", resp.TestDetails.TestId, "nodeName", resp.TestDetails.NodeName)
+		}
+		c.stream.publish(StreamEvent{Time: receivedAt, Outcome: OutcomeDuplicate, Response: resp})
+		return OutcomeDuplicate
+	case errors.Is(err, errOutOfOrder):
+		c.outOfOrder.Add(1)
+		if c.cfg.VerboseLogging {
+			c.logger.Log("level", "info", "msg", "Ignored out-of-order result", "testID", resp.TestDetails.TestId, "nodeName", resp.TestDetails.NodeName, "timestamp", resp.Summary.Timestamp)
+		}
+		c.stream.publish(StreamEvent{Time: receivedAt, Outcome: OutcomeOutOfOrder, Response: resp})
+		return OutcomeOutOfOrder
+	}
+	if limit != "" && c.cfg.VerboseLogging {
+		c.logger.Log("level", "info", "msg", "Evicted least recently updated series", "testID", resp.TestDetails.TestId, "limit", limit)
+	}
+	if c.cfg.HostsLimit > 0 && len(resp.Hosts) > c.cfg.HostsLimit {
+		c.limitHits[limitHostsPerResult].Add(1)
+	}
+	if c.cfg.StepsLimit > 0 && len(resp.Steps) > c.cfg.StepsLimit {
+		c.limitHits[limitStepsPerResult].Add(1)
+	}
+	c.history.add(*resp, receivedAt)
+	c.stream.publish(StreamEvent{Time: receivedAt, Outcome: OutcomeAccepted, Response: resp})
+	return OutcomeAccepted
+}
+
+// authorized reports whether r carries the configured secret, either as a
+// bearer token or as the token query parameter.
+func (c *Collector) authorized(r *http.Request) bool {
+	if c.cfg.Secret == "" {
+		return true
+	}
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(c.cfg.Secret)) == 1
+}
+
+// jsonContentType reports whether a webhook with the Content-Type header
+// value contentType may carry JSON. A missing header is accepted, as not
+// every sender sets one.
+func jsonContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+func (c *Collector) clientAllowed(clientID string) bool {
+	if len(c.cfg.AllowedClientIDs) == 0 {
+		return true
+	}
+	for _, id := range c.cfg.AllowedClientIDs {
+		if id == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// SetJournal makes HandleWebhook append every accepted webhook body to j.
+func (c *Collector) SetJournal(j *Journal) {
+	c.journal = j
+}
 
-	c.latestResponse = &resp
-	w.WriteHeader(http.StatusOK)
+// SetReplicator makes HandleWebhook forward every accepted webhook that was not
+// itself replicated to the replicator's peers.
+func (c *Collector) SetReplicator(r *Replicator) {
+	c.replicator = r
+}
+
+// SetAlertmanager makes HandleAlertWebhook send every alert that triggers,
+// changes its level or clears to Alertmanager.
+func (c *Collector) SetAlertmanager(n *AlertmanagerNotifier) {
+	c.alertmanager = n
+}
+
+// reject records a webhook that could not be accepted.
+func (c *Collector) reject(body []byte, err error, t time.Time) {
+	c.webhooksRejected.Add(1)
+	c.up.Set(0)
+	c.history.addRejection(body, err, t)
+	c.stream.publish(StreamEvent{Time: t, Outcome: OutcomeRejected, Error: err.Error()})
+}
+
+// seriesLabels returns the labels of the series a result belongs to: the
+// TestDetails and node labels after applying the relabel configs. It reports
+// false if the result was dropped by a keep or drop rule. With
+// DropNodeNameLabel, node_name is only input to the relabel configs. Labels
+// that clash with the configured constant labels are removed and values are
+// truncated to the label value length limit.
+func (c *Collector) seriesLabels(details *TestDetails) (Labels, bool) {
+	labels := map[string]string{
+		testIDLabel:        details.TestId,
+		nodeIDLabel:        details.NodeId,
+		nodeNameLabel:      details.NodeName,
+		testNameLabel:      details.TestName,
+		clientIDLabel:      details.ClientId,
+		asnLabel:           details.Asn,
+		divisionIDLabel:    details.DivisionId,
+		monitorTypeIDLabel: details.MonitorTypeId,
+		typeIDLabel:        details.TypeId,
+	}
+	c.addNodeLabels(labels, details)
+	if !relabel(labels, c.cfg.RelabelConfigs) {
+		return nil, false
+	}
+	if c.cfg.DropNodeNameLabel {
+		delete(labels, nodeNameLabel)
+	}
+	for name := range c.cfg.Labels {
+		delete(labels, name)
+	}
+	if limit := c.cfg.LabelValueLengthLimit; limit > 0 {
+		for name, value := range labels {
+			if len(value) > limit {
+				// Cut at the byte limit and drop a partial trailing rune.
+				labels[name] = strings.ToValidUTF8(value[:limit], "")
+				c.limitHits[limitLabelValueLength].Add(1)
+			}
+		}
+	}
+	return labelsFromMap(labels), true
 }
 
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	ch <- c.up
-	if c.latestResponse == nil {
+	ch <- prometheus.MustNewConstMetric(c.webhooksReceivedMetric, prometheus.CounterValue, float64(c.webhooksAccepted.Load()), OutcomeAccepted)
+	ch <- prometheus.MustNewConstMetric(c.webhooksReceivedMetric, prometheus.CounterValue, float64(c.webhooksRejected.Load()), OutcomeRejected)
+	for rule, count := range c.webhooksFiltered {
+		ch <- prometheus.MustNewConstMetric(c.webhookFilteredMetric, prometheus.CounterValue, float64(count.Load()), rule)
+	}
+	ch <- prometheus.MustNewConstMetric(c.outOfOrderMetric, prometheus.CounterValue, float64(c.outOfOrder.Load()))
+	ch <- prometheus.MustNewConstMetric(c.duplicatesMetric, prometheus.CounterValue, float64(c.duplicates.Load()))
+	if c.queue != nil {
+		c.queue.collect(ch)
+	}
+	if c.sources.Load().restricted() {
+		ch <- prometheus.MustNewConstMetric(c.sourceRejectedMetric, prometheus.CounterValue, float64(c.sourceRejected.Load()))
+	}
+	if c.limiter != nil {
+		ch <- prometheus.MustNewConstMetric(c.throttledMetric, prometheus.CounterValue, float64(c.throttled.Load()))
+	}
+	for limit, count := range c.limitHits {
+		ch <- prometheus.MustNewConstMetric(c.limitHitsMetric, prometheus.CounterValue, float64(count.Load()), limit)
+	}
+	c.alerts.collect(ch)
+	if c.cfg.ParseNodeNames {
+		ch <- prometheus.MustNewConstMetric(c.nodeNameErrorsMetric, prometheus.CounterValue, float64(c.nodeNameErrors.Load()))
+	}
+
+	series := c.store.list(time.Now())
+	if len(series) == 0 {
 		if c.cfg.VerboseLogging {
 			c.logger.Log("level", "warn", "msg", "No data available to collect")
 		}
 		return
 	}
 
-	resp := c.latestResponse
+	nodes := make(map[string]string)
+	for i := range series {
+		c.collectResponse(ch, &series[i])
+		if details := &series[i].Response.TestDetails; details.NodeId != "" {
+			nodes[details.NodeId] = details.NodeName
+		}
+	}
+	for id, name := range nodes {
+		ch <- prometheus.MustNewConstMetric(c.nodeInfoMetric, prometheus.GaugeValue, 1, id, name)
+	}
+}
+
+func (c *Collector) collectResponse(ch chan<- prometheus.Metric, series *Series) {
+	resp := &series.Response
 	if c.cfg.VerboseLogging {
 		c.logger.Log("level", "debug", "msg", "Collecting metrics", "responseID", resp.TestDetails.TestId)
 	}
 
-	labels := []string{
-		resp.TestDetails.TestId,
-		resp.TestDetails.NodeName,
-		resp.TestDetails.TestName,
-		resp.TestDetails.ClientId,
-		resp.TestDetails.Asn,
-		resp.TestDetails.DivisionId,
-		resp.TestDetails.MonitorTypeId,
-		resp.TestDetails.TypeId,
-	}
+	labels := series.Labels
 
 	// Emit metrics
 	c.emitMetric(ch, c.totalTimeMetric, resp.Summary.TotalTime, labels)
@@ -576,6 +951,12 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	c.emitMetric(ch, c.clientTimeMetric, resp.Summary.Client, labels)
 	c.emitMetric(ch, c.documentCompleteTimeMetric, resp.Summary.DocumentComplete, labels)
 	c.emitMetric(ch, c.renderStartTimeMetric, resp.Summary.RenderStart, labels)
+	c.emitMetric(ch, c.firstContentfulPaintMetric, resp.Summary.FirstContentfulPaint, labels)
+	c.emitMetric(ch, c.largestContentfulPaintMetric, resp.Summary.LargestContentfulPaint, labels)
+	c.emitMetric(ch, c.cumulativeLayoutShiftMetric, resp.Summary.CumulativeLayoutShift, labels)
+	c.emitMetric(ch, c.totalBlockingTimeMetric, resp.Summary.TotalBlockingTime, labels)
+	c.emitMetric(ch, c.timeToInteractiveMetric, resp.Summary.TimeToInteractive, labels)
+	c.emitMetric(ch, c.speedIndexMetric, resp.Summary.SpeedIndex, labels)
 	c.emitMetric(ch, c.responseContentSizeMetric, resp.Summary.ResponseContent, labels)
 	c.emitMetric(ch, c.responseHeadersSizeMetric, resp.Summary.ResponseHeaders, labels)
 	c.emitMetric(ch, c.totalContentSizeMetric, resp.Summary.TotalContent, labels)
@@ -609,23 +990,63 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	c.emitMetric(ch, c.xmlCountMetric, resp.Summary.XMLCount, labels)
 	c.emitMetric(ch, c.mediaCountMetric, resp.Summary.MediaCount, labels)
 	c.emitMetric(ch, c.tracepointsCountMetric, resp.Summary.TracepointsCount, labels)
+
+	c.collectSteps(ch, series)
+	c.collectHosts(ch, series)
+	c.collectTestType(ch, series)
 }
 
-func (c *Collector) emitMetric(ch chan<- prometheus.Metric, metricDesc *prometheus.Desc, valueStr string, labels []string) {
+func (c *Collector) emitMetric(ch chan<- prometheus.Metric, metric *seriesMetric, valueStr string, labels Labels) {
 	if valueStr == "" {
 		if c.cfg.VerboseLogging {
-			c.logger.Log("level", "debug", "msg", "Skipping metric emission due to empty value", "metric", metricDesc.String())
+			c.logger.Log("level", "debug", "msg", "Skipping metric emission due to empty value", "metric", metric.name)
 		}
 		return
 	}
 
 	value, err := parseMetricValue(valueStr)
 	if err != nil {
-		c.logger.Log("level", "error", "msg", "Failed to parse metric value", "metric", metricDesc.String(), "error", err)
+		c.logger.Log("level", "error", "msg", "Failed to parse metric value", "metric", metric.name, "error", err)
 		return
 	}
+	c.emitValue(ch, metric, value, labels)
+}
+
+func (c *Collector) emitValue(ch chan<- prometheus.Metric, metric *seriesMetric, value float64, labels Labels) {
+	names, values := labels.namesAndValues()
+	ch <- prometheus.MustNewConstMetric(metric.desc(names), prometheus.GaugeValue, value, values...)
+}
+
+// seriesMetric is a per-result gauge. Its label names depend on the relabel
+// configs, so descriptors are created and cached per label name set.
+type seriesMetric struct {
+	name        string
+	help        string
+	constLabels prometheus.Labels
+
+	mu    sync.Mutex
+	descs map[string]*prometheus.Desc
+}
+
+func newSeriesMetric(name, help string, constLabels prometheus.Labels) *seriesMetric {
+	return &seriesMetric{
+		name:        name,
+		help:        help,
+		constLabels: constLabels,
+		descs:       make(map[string]*prometheus.Desc),
+	}
+}
 
-	ch <- prometheus.MustNewConstMetric(metricDesc, prometheus.GaugeValue, value, labels...)
+func (m *seriesMetric) desc(labelNames []string) *prometheus.Desc {
+	key := strings.Join(labelNames, "\xff")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.descs[key]
+	if !ok {
+		d = prometheus.NewDesc(m.name, m.help, labelNames, m.constLabels)
+		m.descs[key] = d
+	}
+	return d
 }
 
 func parseMetricValue(valueStr string) (float64, error) {
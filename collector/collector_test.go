@@ -61,6 +61,12 @@ func TestCollectorWithData(t *testing.T) {
 	        "Client": "167",
 	        "DocumentComplete": "4406",
 	        "RenderStart": "1554",
+	        "FirstContentfulPaint": "1320",
+	        "LargestContentfulPaint": "2480",
+	        "CumulativeLayoutShift": "0.08",
+	        "TotalBlockingTime": "190",
+	        "TimeToInteractive": "3900",
+	        "SpeedIndex": "2105",
 	        "ResponseContent": "101392",
 	        "ResponseHeaders": "2315",
 	        "TotalContent": "1567691",
@@ -107,7 +113,7 @@ func TestCollectorWithData(t *testing.T) {
 	}
 
 	// Define expected metric count
-	expectedMetricCount := 45 // 44 metrics + 1(up) for the collector
+	expectedMetricCount := 55 // 50 metrics + 1(up) + 1(webhooks received) + 1(node info) + 2(out of order and duplicates) for the collector
 	if len(metrics) != expectedMetricCount {
 		t.Errorf("expected %d metrics, got %d", expectedMetricCount, len(metrics))
 	}
@@ -162,6 +168,12 @@ func TestCollectorWithEmptyResponse(t *testing.T) {
 	        "Client": "",
 	        "DocumentComplete": "",
 	        "RenderStart": "",
+	        "FirstContentfulPaint": "",
+	        "LargestContentfulPaint": "",
+	        "CumulativeLayoutShift": "",
+	        "TotalBlockingTime": "",
+	        "TimeToInteractive": "",
+	        "SpeedIndex": "",
 	        "ResponseContent": "",
 	        "ResponseHeaders": "",
 	        "TotalContent": "",
@@ -212,7 +224,7 @@ func TestCollectorWithEmptyResponse(t *testing.T) {
 	}
 
 	// Define expected metric count
-	expectedMetricCount := 1 // Assuming 1 'up' metric for the collector
+	expectedMetricCount := 5 // up, webhooks received, node info, out of order and duplicates metrics for the collector
 	if len(metrics) != expectedMetricCount {
 		t.Errorf("expected %d metrics, got %d", expectedMetricCount, len(metrics))
 	}
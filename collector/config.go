@@ -14,16 +14,336 @@
 
 package collector
 
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// TenantLabel is added to every metric of a tenant.
+const TenantLabel = "tenant"
+
+// reservedPaths are served by the exporter itself and cannot be used as tenant
+// webhook paths, nor can paths below tenantsPrefix, where the status pages of
+// tenants are served.
+var reservedPaths = []string{"/", "/metrics", "/-/healthy", "/-/ready", "/-/reload"}
+
+const tenantsPrefix = "/tenants/"
+
 type Config struct {
 	VerboseLogging bool
 	Port           string
 	WebhookPath    string
+	// AlertWebhookPath receives alert webhooks, see HandleAlertWebhook.
+	AlertWebhookPath string
+	HistorySize      int
+	StaleAfter       time.Duration
+	SeriesTTL        time.Duration
+
+	// ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout configure
+	// the HTTP server. On shutdown the exporter reports not ready for
+	// DrainPeriod, so load balancers stop sending webhooks, then waits up to
+	// ShutdownTimeout for in-flight requests.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	DrainPeriod       time.Duration
+	ShutdownTimeout   time.Duration
+
+	// Cardinality limits, disabled when not positive. SeriesLimitPolicy is
+	// LimitPolicyReject or LimitPolicyEvict.
+	SeriesLimit           int
+	SeriesLimitPerTest    int
+	LabelValueLengthLimit int
+	SeriesLimitPolicy     string
+	// HostsLimit is the number of hosts of a result exported with a host
+	// label, the ones ranking highest by HostsRankBy. The other hosts are
+	// merged into one.
+	HostsLimit  int
+	HostsRankBy string
+	// StepsLimit is the number of steps of a result exported, the first
+	// ones. The other steps are dropped.
+	StepsLimit int
+
+	// TestTypes maps TypeId values to test types, see TestTypeWeb. Nil uses
+	// DefaultTestTypes.
+	TestTypes map[string]string
+
+	// IdempotencyTTL is how long responses to requests with an
+	// Idempotency-Key are remembered. 0 disables the cache.
+	IdempotencyTTL time.Duration
+
+	// WebhookMaxBodySize limits the size of webhook bodies in bytes and
+	// WebhookMaxDecodedSize the size of compressed bodies after decoding.
+	// WebhookRateLimit limits the webhooks per second per source IP, allowing
+	// bursts of WebhookRateBurst. Both are disabled when not positive.
+	WebhookMaxBodySize    int64
+	WebhookMaxDecodedSize int64
+	WebhookRateLimit      float64
+	WebhookRateBurst      int
+	// Sources restricts the source IPs webhooks are accepted from. All
+	// sources are accepted when nil.
+	Sources *SourcePolicy
+
+	// IngestWorkers process decoded webhooks from a queue of IngestQueueSize
+	// entries. With no workers webhooks are processed by the handler.
+	IngestWorkers   int
+	IngestQueueSize int
+
+	PersistenceFile     string
+	PersistenceInterval time.Duration
+
+	JournalDir      string
+	JournalMaxSize  int64
+	JournalMaxFiles int
+
+	// ReplicationSecret is shared by all peers and must be set for the
+	// replication headers of webhooks to be honored.
+	ReplicationPeers      []string
+	ReplicationInstanceID string
+	ReplicationSecret     string
+
+	// AlertmanagerURLs receive the alerts of the alert webhook, see
+	// AlertmanagerNotifier.
+	AlertmanagerURLs           []string
+	AlertmanagerResendInterval time.Duration
+	AlertmanagerTestURL        string
+
+	// Tenant settings. Secret, when set, must be presented by webhook
+	// senders as a bearer token. AllowedClientIDs restricts the accepted
+	// ClientId values and Labels are added to every metric.
+	Secret           string
+	AllowedClientIDs []string
+	Labels           map[string]string
+	MetricsPath      string
+
+	// Filters decide which results are stored, see FilterRule.
+	Filters []FilterRule
+	// RelabelConfigs rewrite the labels derived from TestDetails, see
+	// RelabelConfig.
+	RelabelConfigs []RelabelConfig
+
+	// ParseNodeNames adds node_city, node_country and node_isp labels parsed
+	// from NodeName. NodeLookup adds the location of known NodeId values.
+	ParseNodeNames bool
+	NodeLookup     NodeLookup
+	// DropNodeNameLabel removes the node_name label from result metrics after
+	// relabeling, so node names are only exported by catchpoint_node_info.
+	DropNodeNameLabel bool
 }
 
 func NewConfig() *Config {
 	return &Config{
-		VerboseLogging: false,
-		Port:           "9090",
-		WebhookPath:    "/webhook",
+		VerboseLogging:   false,
+		Port:             "9090",
+		WebhookPath:      "/webhook",
+		AlertWebhookPath: "/webhook/alerts",
+		MetricsPath:      "/metrics",
+		HistorySize:      10,
+		StaleAfter:       time.Hour,
+
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		ShutdownTimeout:   30 * time.Second,
+
+		WebhookMaxBodySize:    10 << 20,
+		WebhookMaxDecodedSize: 50 << 20,
+		WebhookRateBurst:      10,
+
+		PersistenceInterval: time.Minute,
+
+		JournalMaxSize:  64 << 20,
+		JournalMaxFiles: 10,
+
+		AlertmanagerResendInterval: time.Minute,
+	}
+}
+
+// FileConfig is the configuration read from the file given by --config.file.
+type FileConfig struct {
+	Filters        []FilterRule    `yaml:"filters"`
+	RelabelConfigs []RelabelConfig `yaml:"relabel_configs"`
+	Tenants        []TenantConfig  `yaml:"tenants"`
+	// Sources applies to the webhook endpoints of all tenants and is
+	// reloaded without a restart.
+	Sources SourceConfig `yaml:"webhook_sources"`
+	// TestTypes maps TypeId values to test types, replacing the
+	// DefaultTestTypes entries of the same TypeId.
+	TestTypes map[string]string `yaml:"test_types"`
+}
+
+// TenantConfig configures a separate webhook endpoint with its own state and
+// metrics for one Catchpoint account or business unit.
+type TenantConfig struct {
+	Name             string            `yaml:"name"`
+	WebhookPath      string            `yaml:"webhook_path"`
+	Secret           string            `yaml:"secret"`
+	AllowedClientIDs []string          `yaml:"allowed_client_ids"`
+	Labels           map[string]string `yaml:"labels"`
+	// MetricsEndpoint serves the tenant's metrics on /metrics/{name} only,
+	// instead of on the shared /metrics endpoint.
+	MetricsEndpoint bool `yaml:"metrics_endpoint"`
+	// Filters and RelabelConfigs are applied after the global ones.
+	Filters        []FilterRule    `yaml:"filters"`
+	RelabelConfigs []RelabelConfig `yaml:"relabel_configs"`
+}
+
+// LoadConfigFile reads and validates the configuration file at path.
+func LoadConfigFile(path string) (*FileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	cfg := &FileConfig{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file: %w", err)
+	}
+	return cfg, nil
+}
+
+func validateFilters(rules ...[]FilterRule) error {
+	names := make(map[string]bool)
+	for _, list := range rules {
+		for i := range list {
+			if err := list[i].validate(); err != nil {
+				return fmt.Errorf("filter %d: %w", i, err)
+			}
+			if names[list[i].Name] {
+				return fmt.Errorf("filter %q: duplicate name", list[i].Name)
+			}
+			names[list[i].Name] = true
+		}
+	}
+	return nil
+}
+
+func validateRelabelConfigs(cfgs []RelabelConfig) error {
+	for i := range cfgs {
+		if err := cfgs[i].validate(); err != nil {
+			return fmt.Errorf("relabel config %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (c *FileConfig) validate() error {
+	if err := validateFilters(c.Filters); err != nil {
+		return err
+	}
+	if err := validateRelabelConfigs(c.RelabelConfigs); err != nil {
+		return err
+	}
+	if _, err := NewSourcePolicy(c.Sources); err != nil {
+		return fmt.Errorf("webhook_sources: %w", err)
+	}
+	if err := validateTestTypes(c.TestTypes); err != nil {
+		return fmt.Errorf("test_types: %w", err)
+	}
+
+	// Paths registered twice make the HTTP server panic on startup.
+	paths := make(map[string]string)
+	for _, path := range reservedPaths {
+		paths[path] = "reserved path"
+	}
+	for _, t := range c.Tenants {
+		if t.MetricsEndpoint {
+			paths["/metrics/"+t.Name] = fmt.Sprintf("metrics path of tenant %q", t.Name)
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, t := range c.Tenants {
+		if t.Name == "" {
+			return fmt.Errorf("tenant %d: name is required", i)
+		}
+		if strings.Contains(t.Name, "/") {
+			return fmt.Errorf("tenant %q: name must not contain '/'", t.Name)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("tenant %q: duplicate name", t.Name)
+		}
+		names[t.Name] = true
+
+		if !strings.HasPrefix(t.WebhookPath, "/") {
+			return fmt.Errorf("tenant %q: webhook_path must start with '/'", t.Name)
+		}
+		if strings.HasPrefix(t.WebhookPath, tenantsPrefix) {
+			return fmt.Errorf("tenant %q: webhook_path must not be below %q", t.Name, tenantsPrefix)
+		}
+		// Alert webhooks are received below the webhook path.
+		for _, path := range []string{t.WebhookPath, t.WebhookPath + "/alerts"} {
+			if used, ok := paths[path]; ok {
+				return fmt.Errorf("tenant %q: webhook_path %q collides with the %s", t.Name, path, used)
+			}
+			paths[path] = fmt.Sprintf("webhook path of tenant %q", t.Name)
+		}
+
+		for name := range t.Labels {
+			if !model.LabelName(name).IsValid() || name == TenantLabel {
+				return fmt.Errorf("tenant %q: invalid label name %q", t.Name, name)
+			}
+		}
+		if err := validateFilters(c.Filters, t.Filters); err != nil {
+			return fmt.Errorf("tenant %q: %w", t.Name, err)
+		}
+		if err := validateRelabelConfigs(t.RelabelConfigs); err != nil {
+			return fmt.Errorf("tenant %q: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// Apply returns a copy of base configured for the tenant. Alert webhooks are
+// received on the webhook path followed by /alerts. Persistence files and
+// journal directories are made unique per tenant and peer URLs are pointed at
+// the tenant's webhook path.
+func (t TenantConfig) Apply(base *Config) *Config {
+	cfg := *base
+	cfg.WebhookPath = t.WebhookPath
+	cfg.AlertWebhookPath = t.WebhookPath + "/alerts"
+	cfg.Secret = t.Secret
+	cfg.AllowedClientIDs = t.AllowedClientIDs
+
+	cfg.Filters = append(append([]FilterRule(nil), base.Filters...), t.Filters...)
+	cfg.RelabelConfigs = append(append([]RelabelConfig(nil), base.RelabelConfigs...), t.RelabelConfigs...)
+
+	cfg.Labels = map[string]string{TenantLabel: t.Name}
+	for name, value := range t.Labels {
+		cfg.Labels[name] = value
+	}
+
+	cfg.MetricsPath = base.MetricsPath
+	if t.MetricsEndpoint {
+		cfg.MetricsPath = base.MetricsPath + "/" + t.Name
+	}
+	if base.PersistenceFile != "" {
+		cfg.PersistenceFile = base.PersistenceFile + "." + t.Name
+	}
+	if base.JournalDir != "" {
+		cfg.JournalDir = filepath.Join(base.JournalDir, t.Name)
+	}
+
+	cfg.ReplicationPeers = make([]string, 0, len(base.ReplicationPeers))
+	for _, peer := range base.ReplicationPeers {
+		u, err := url.Parse(peer)
+		if err != nil {
+			continue
+		}
+		u.Path = t.WebhookPath
+		cfg.ReplicationPeers = append(cfg.ReplicationPeers, u.String())
 	}
+	return &cfg
 }
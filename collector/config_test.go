@@ -0,0 +1,152 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal("failed to write config file:", err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+tenants:
+  - name: retail
+    webhook_path: /webhook/retail
+    secret: s3cret
+    allowed_client_ids: ["123"]
+    labels:
+      business_unit: retail
+  - name: travel
+    webhook_path: /webhook/travel
+    metrics_endpoint: true
+`)
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatal("failed to load config file:", err)
+	}
+	if len(cfg.Tenants) != 2 {
+		t.Fatalf("expected 2 tenants, got %d", len(cfg.Tenants))
+	}
+
+	base := NewConfig()
+	base.PersistenceFile = "/var/lib/state.json"
+	base.ReplicationPeers = []string{"http://peer:9090/webhook"}
+
+	retail := cfg.Tenants[0].Apply(base)
+	if retail.Labels[TenantLabel] != "retail" || retail.Labels["business_unit"] != "retail" {
+		t.Errorf("unexpected tenant labels: %v", retail.Labels)
+	}
+	if retail.MetricsPath != "/metrics" || retail.PersistenceFile != "/var/lib/state.json.retail" {
+		t.Errorf("unexpected tenant config: %+v", retail)
+	}
+	if retail.ReplicationPeers[0] != "http://peer:9090/webhook/retail" {
+		t.Errorf("expected peers to target the tenant webhook path, got %v", retail.ReplicationPeers)
+	}
+	if travel := cfg.Tenants[1].Apply(base); travel.MetricsPath != "/metrics/travel" {
+		t.Errorf("expected a separate metrics path, got %q", travel.MetricsPath)
+	}
+}
+
+func TestLoadConfigFileInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"missing name":   "tenants:\n  - webhook_path: /a\n",
+		"duplicate path": "tenants:\n  - {name: a, webhook_path: /a}\n  - {name: b, webhook_path: /a}\n",
+		"relative path":  "tenants:\n  - {name: a, webhook_path: a}\n",
+		"alert path":     "tenants:\n  - {name: a, webhook_path: /a}\n  - {name: b, webhook_path: /a/alerts}\n",
+		"metrics path":   "tenants:\n  - {name: a, webhook_path: /metrics}\n",
+		"health path":    "tenants:\n  - {name: a, webhook_path: /-/healthy}\n",
+		"reload path":    "tenants:\n  - {name: a, webhook_path: /-/reload}\n",
+		"root path":      "tenants:\n  - {name: a, webhook_path: /}\n",
+		"tenants prefix": "tenants:\n  - {name: a, webhook_path: /tenants/a/}\n",
+		"tenant metrics": "tenants:\n  - {name: a, webhook_path: /metrics/b}\n  - {name: b, webhook_path: /b, metrics_endpoint: true}\n",
+		"invalid label":  "tenants:\n  - {name: a, webhook_path: /a, labels: {tenant: x}}\n",
+		"unknown field":  "tenants:\n  - {name: a, webhook_path: /a, unknown: x}\n",
+		"invalid source": "webhook_sources:\n  allowed_ranges: [192.0.2.0/33]\n",
+		"invalid type":   "test_types:\n  \"12\": smtp\n",
+	} {
+		if _, err := LoadConfigFile(writeConfigFile(t, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestTenantWebhookAuthorization(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	cfg := TenantConfig{
+		Name:             "retail",
+		WebhookPath:      "/webhook/retail",
+		Secret:           "s3cret",
+		AllowedClientIDs: []string{"123"},
+	}.Apply(NewConfig())
+	collector := NewCollector(logger, cfg)
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	send := func(token, clientID string) int {
+		resp := testResponse("1", "Paris", "100")
+		resp.TestDetails.ClientId = clientID
+		body, _ := json.Marshal(resp)
+		req := httptest.NewRequest("POST", "/webhook/retail", bytes.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		collector.HandleWebhook(w, req)
+		return w.Code
+	}
+
+	if code := send("", "123"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", code)
+	}
+	if code := send("wrong", "123"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with a wrong token, got %d", code)
+	}
+	if code := send("s3cret", "456"); code != http.StatusForbidden {
+		t.Errorf("expected 403 for a disallowed client, got %d", code)
+	}
+	if code := send("s3cret", "123"); code != http.StatusOK {
+		t.Errorf("expected 200, got %d", code)
+	}
+
+	expected := `
+# HELP catchpoint_total_time Total time it took to load the webpage in milliseconds.
+# TYPE catchpoint_total_time gauge
+catchpoint_total_time{asn="",client_id="123",division_id="",monitor_type_id="",node_id="Paris",node_name="Paris",tenant="retail",test_id="1",test_name="My Homepage",type_id=""} 100
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), TotalTimeMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+	errDecodedBodyTooLarge = errors.New("decompressed request body too large")
+)
+
+// decodeBody returns a reader of body decoded according to the
+// Content-Encoding header value encoding. Reading more than limit decoded
+// bytes fails with errDecodedBodyTooLarge, which protects against
+// decompression bombs. A limit that is not positive disables the check.
+func decodeBody(body io.Reader, encoding string, limit int64) (io.ReadCloser, error) {
+	var (
+		decoded io.ReadCloser
+		err     error
+	)
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		// Uncompressed bodies are bounded by the body size limit already.
+		return io.NopCloser(body), nil
+	case "gzip", "x-gzip":
+		decoded, err = gzip.NewReader(body)
+	case "deflate":
+		decoded, err = newDeflateReader(body)
+	case "zstd":
+		decoded, err = newZstdReader(body, limit)
+	default:
+		return nil, fmt.Errorf("%w %q", errUnsupportedEncoding, encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return decoded, nil
+	}
+	return &limitedReadCloser{ReadCloser: decoded, remaining: limit}, nil
+}
+
+// newDeflateReader reads deflate bodies. HTTP defines deflate as the zlib
+// format, but some clients send raw deflate data, so the zlib header is
+// detected like browsers do.
+func newDeflateReader(body io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(body)
+	header, err := buffered.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
+
+// newZstdReader reads zstd bodies. The window and memory of the decoder are
+// bounded by limit, as the window is allocated before any byte is decoded.
+func newZstdReader(body io.Reader, limit int64) (io.ReadCloser, error) {
+	options := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if limit > 0 {
+		window := uint64(limit)
+		if window < zstd.MinWindowSize {
+			window = zstd.MinWindowSize
+		}
+		options = append(options, zstd.WithDecoderMaxMemory(uint64(limit)), zstd.WithDecoderMaxWindow(window))
+	}
+	decoder, err := zstd.NewReader(body, options...)
+	if err != nil {
+		return nil, err
+	}
+	return zstdReadCloser{decoder.IOReadCloser()}, nil
+}
+
+// zstdReadCloser reports frames exceeding the decoder limits as
+// errDecodedBodyTooLarge.
+type zstdReadCloser struct {
+	io.ReadCloser
+}
+
+func (z zstdReadCloser) Read(p []byte) (int, error) {
+	n, err := z.ReadCloser.Read(p)
+	if errors.Is(err, zstd.ErrWindowSizeExceeded) || errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		err = errDecodedBodyTooLarge
+	}
+	return n, err
+}
+
+// limitedReadCloser fails once more than remaining bytes are read, unlike
+// io.LimitReader which silently truncates.
+type limitedReadCloser struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (l *limitedReadCloser) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Probe for data beyond the limit.
+		var probe [1]byte
+		n, err := l.ReadCloser.Read(probe[:])
+		if n > 0 {
+			return 0, errDecodedBodyTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,155 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/common/promlog"
+)
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "zstd":
+		var err error
+		if w, err = zstd.NewWriter(&buf); err != nil {
+			t.Fatal("failed to create zstd writer:", err)
+		}
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal("failed to compress body:", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal("failed to compress body:", err)
+	}
+	return buf.Bytes()
+}
+
+func TestWebhookContentEncoding(t *testing.T) {
+	body, err := json.Marshal(testResponse("1", "Paris", "100"))
+	if err != nil {
+		t.Fatal("failed to marshal response:", err)
+	}
+
+	tests := []struct {
+		name     string
+		header   string
+		body     []byte
+		expected int
+	}{
+		{"identity", "identity", body, http.StatusOK},
+		{"gzip", "gzip", compress(t, "gzip", body), http.StatusOK},
+		{"deflate", "deflate", compress(t, "deflate", body), http.StatusOK},
+		{"raw deflate", "deflate", compress(t, "raw-deflate", body), http.StatusOK},
+		{"zstd", "zstd", compress(t, "zstd", body), http.StatusOK},
+		{"corrupt", "gzip", body, http.StatusBadRequest},
+		{"unsupported", "br", body, http.StatusUnsupportedMediaType},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger := promlog.New(&promlog.Config{})
+			collector := NewCollector(logger, &Config{WebhookMaxDecodedSize: 1 << 20})
+
+			req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(test.body))
+			req.Header.Set("Content-Encoding", test.header)
+			w := httptest.NewRecorder()
+			collector.HandleWebhook(w, req)
+			if w.Code != test.expected {
+				t.Fatalf("expected status %d, got %d: %s", test.expected, w.Code, w.Body)
+			}
+			if test.expected == http.StatusOK && len(storedNodes(collector)) != 1 {
+				t.Errorf("expected the decoded result to be stored, got %v", storedNodes(collector))
+			}
+		})
+	}
+}
+
+func TestWebhookDecodedSizeLimit(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{WebhookMaxBodySize: 1 << 20, WebhookMaxDecodedSize: 1 << 20})
+
+	// A few kilobytes that decompress to more than the limit.
+	bomb := compress(t, "gzip", bytes.Repeat([]byte(" "), 2<<20))
+	if len(bomb) > 1<<20 {
+		t.Fatalf("expected the compressed body to be within the body size limit, got %d bytes", len(bomb))
+	}
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(bomb))
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	collector.HandleWebhook(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413, got %d", w.Code)
+	}
+}
+
+func TestWebhookZstdWindowLimit(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{WebhookMaxBodySize: 1 << 20, WebhookMaxDecodedSize: 1 << 20})
+
+	// A frame declaring a 512 MiB window, followed by a small RLE block.
+	frame := []byte{
+		0x28, 0xb5, 0x2f, 0xfd, // magic number
+		0x00,             // frame header descriptor: no content size
+		19 << 3,          // window descriptor: 2^(10+19) bytes
+		0x03, 0x10, 0x00, // last RLE block of 512 bytes
+		' ',
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(frame))
+	req.Header.Set("Content-Encoding", "zstd")
+	w := httptest.NewRecorder()
+	collector.HandleWebhook(w, req)
+	runtime.ReadMemStats(&after)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413, got %d: %s", w.Code, w.Body)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+		t.Errorf("expected the window not to be allocated, got %d bytes allocated", allocated)
+	}
+}
+
+func TestLimitedReadCloser(t *testing.T) {
+	for size, expectErr := range map[int]bool{9: false, 10: false, 11: true} {
+		r := &limitedReadCloser{ReadCloser: io.NopCloser(bytes.NewReader(make([]byte, size))), remaining: 10}
+		data, err := io.ReadAll(r)
+		if expectErr != (err == errDecodedBodyTooLarge) {
+			t.Errorf("size %d: unexpected error %v", size, err)
+		}
+		if !expectErr && len(data) != size {
+			t.Errorf("size %d: expected all data, got %d bytes", size, len(data))
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	FilterInclude = "include"
+	FilterExclude = "exclude"
+
+	// noIncludeMatchRule is the rule label of results dropped because they
+	// matched none of the include rules.
+	noIncludeMatchRule = "no_include_match"
+)
+
+// Regexp is a regular expression that is anchored at both ends, as in
+// Prometheus relabel configs.
+type Regexp struct {
+	*regexp.Regexp
+	original string
+}
+
+// NewRegexp compiles s anchored at both ends.
+func NewRegexp(s string) (Regexp, error) {
+	re, err := regexp.Compile("^(?:" + s + ")$")
+	return Regexp{Regexp: re, original: s}, err
+}
+
+// MustNewRegexp is like NewRegexp but panics if s does not compile.
+func MustNewRegexp(s string) Regexp {
+	re, err := NewRegexp(s)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (re *Regexp) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	r, err := NewRegexp(s)
+	if err != nil {
+		return err
+	}
+	*re = r
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (re Regexp) MarshalYAML() (interface{}, error) {
+	return re.original, nil
+}
+
+// String returns the expression as it was configured.
+func (re Regexp) String() string {
+	return re.original
+}
+
+// FilterRule includes or excludes results by matching a TestDetails field
+// either exactly against Value or against Regex.
+type FilterRule struct {
+	Name   string `yaml:"name"`
+	Action string `yaml:"action"`
+	Field  string `yaml:"field"`
+	Value  string `yaml:"value"`
+	Regex  Regexp `yaml:"regex"`
+}
+
+func (r *FilterRule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if r.Name == noIncludeMatchRule || r.Name == relabelDropRule {
+		return fmt.Errorf("name %q is reserved", r.Name)
+	}
+	if r.Action != FilterInclude && r.Action != FilterExclude {
+		return fmt.Errorf("action must be %q or %q", FilterInclude, FilterExclude)
+	}
+	if _, ok := (&TestDetails{}).Field(r.Field); !ok {
+		return fmt.Errorf("unknown TestDetails field %q", r.Field)
+	}
+	if (r.Value == "") == (r.Regex.Regexp == nil) {
+		return fmt.Errorf("exactly one of value or regex is required")
+	}
+	return nil
+}
+
+func (r *FilterRule) matches(details *TestDetails) bool {
+	value, _ := details.Field(r.Field)
+	if r.Regex.Regexp != nil {
+		return r.Regex.MatchString(value)
+	}
+	return value == r.Value
+}
+
+// filterResult reports whether details should be dropped and by which rule.
+// Exclude rules take precedence. If there are include rules, a result must
+// match at least one of them.
+func filterResult(rules []FilterRule, details *TestDetails) (string, bool) {
+	included, hasInclude := false, false
+	for i := range rules {
+		rule := &rules[i]
+		switch rule.Action {
+		case FilterExclude:
+			if rule.matches(details) {
+				return rule.Name, true
+			}
+		case FilterInclude:
+			hasInclude = true
+			if !included && rule.matches(details) {
+				included = true
+			}
+		}
+	}
+	if hasInclude && !included {
+		return noIncludeMatchRule, true
+	}
+	return "", false
+}
@@ -0,0 +1,85 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+)
+
+func TestFilters(t *testing.T) {
+	fileCfg, err := LoadConfigFile(writeConfigFile(t, `
+filters:
+  - name: homepage-tests
+    action: include
+    field: TestName
+    regex: "My Homepage|Checkout"
+  - name: noisy-node
+    action: exclude
+    field: NodeName
+    value: Noisy
+`))
+	if err != nil {
+		t.Fatal("failed to load config file:", err)
+	}
+
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{Filters: fileCfg.Filters})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	postWebhook(t, collector, testResponse("1", "Paris", "100"))
+	postWebhook(t, collector, testResponse("2", "Noisy", "200"))
+	other := testResponse("3", "Paris", "300")
+	other.TestDetails.TestName = "My Homepage v2"
+	postWebhook(t, collector, other)
+
+	series := collector.store.list(time.Now())
+	if len(series) != 1 || series[0].Response.TestDetails.TestId != "1" {
+		t.Errorf("expected only test 1 to be stored, got %+v", series)
+	}
+
+	expected := `
+# HELP catchpoint_webhook_filtered_total Number of results dropped by filter rules by rule.
+# TYPE catchpoint_webhook_filtered_total counter
+catchpoint_webhook_filtered_total{rule="no_include_match"} 1
+catchpoint_webhook_filtered_total{rule="noisy-node"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), WebhookFilteredMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+}
+
+func TestLoadConfigFileInvalidFilters(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown field":  "filters:\n  - {name: a, action: include, field: Unknown, value: x}\n",
+		"unknown action": "filters:\n  - {name: a, action: keep, field: TestId, value: x}\n",
+		"no matcher":     "filters:\n  - {name: a, action: include, field: TestId}\n",
+		"invalid regex":  "filters:\n  - {name: a, action: include, field: TestId, regex: '('}\n",
+		"reserved name":  "filters:\n  - {name: relabel, action: exclude, field: TestId, value: x}\n",
+		"duplicate name": "filters:\n  - {name: a, action: include, field: TestId, value: x}\n  - {name: a, action: exclude, field: TestId, value: y}\n",
+	} {
+		if _, err := LoadConfigFile(writeConfigFile(t, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
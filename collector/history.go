@@ -0,0 +1,289 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Record is a decoded webhook response together with the time it was received.
+type Record struct {
+	ReceivedAt time.Time `json:"received_at"`
+	Response   Response  `json:"response"`
+}
+
+// NodeSummary describes a node that has reported results for a test.
+type NodeSummary struct {
+	NodeName string    `json:"node_name"`
+	NodeId   string    `json:"node_id"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// TestSummary describes a test that has reported results and its nodes.
+type TestSummary struct {
+	TestId   string        `json:"test_id"`
+	TestName string        `json:"test_name"`
+	LastSeen time.Time     `json:"last_seen"`
+	Nodes    []NodeSummary `json:"nodes"`
+}
+
+// NodeResults holds the most recent results of a single node, newest first.
+type NodeResults struct {
+	NodeName string   `json:"node_name"`
+	NodeId   string   `json:"node_id"`
+	Results  []Record `json:"results"`
+}
+
+// Rejection is a webhook payload that was rejected and the reason why.
+type Rejection struct {
+	Time    time.Time `json:"time"`
+	Error   string    `json:"error"`
+	Payload string    `json:"payload"`
+}
+
+const (
+	rejectionHistorySize = 20
+	rejectionPayloadSize = 1024
+)
+
+// history keeps the last N decoded responses per test and node in bounded
+// ring buffers. With a positive maxNodes, the least recently seen node is
+// dropped to make room for a new one beyond maxNodes.
+type history struct {
+	mu       sync.RWMutex
+	size     int
+	maxNodes int
+	nodes    int
+	tests    map[string]*testHistory
+
+	rejections    []Rejection
+	nextRejection int
+}
+
+type testHistory struct {
+	name     string
+	lastSeen time.Time
+	nodes    map[string]*nodeHistory
+}
+
+type nodeHistory struct {
+	id       string
+	name     string
+	lastSeen time.Time
+	records  []Record
+	next     int
+}
+
+func newHistory(size, maxNodes int) *history {
+	return &history{
+		size:     size,
+		maxNodes: maxNodes,
+		tests:    make(map[string]*testHistory),
+
+		rejections: make([]Rejection, 0, rejectionHistorySize),
+	}
+}
+
+// add stores resp in the ring buffer of its test and node. It is a no-op when
+// the history size is not positive.
+func (h *history) add(resp Response, receivedAt time.Time) {
+	if h.size <= 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	details := resp.TestDetails
+	key := historyNodeKey(&details)
+	test, ok := h.tests[details.TestId]
+	if h.maxNodes > 0 && h.nodes >= h.maxNodes && (!ok || test.nodes[key] == nil) {
+		h.evictOldest()
+		test, ok = h.tests[details.TestId]
+	}
+	if !ok {
+		test = &testHistory{nodes: make(map[string]*nodeHistory)}
+		h.tests[details.TestId] = test
+	}
+	test.name = details.TestName
+	test.lastSeen = receivedAt
+
+	node, ok := test.nodes[key]
+	if !ok {
+		node = &nodeHistory{records: make([]Record, 0, h.size)}
+		test.nodes[key] = node
+		h.nodes++
+	}
+	node.id = details.NodeId
+	node.name = details.NodeName
+	node.lastSeen = receivedAt
+
+	record := Record{ReceivedAt: receivedAt, Response: resp}
+	if len(node.records) < h.size {
+		node.records = append(node.records, record)
+	} else {
+		node.records[node.next] = record
+	}
+	node.next = (node.next + 1) % h.size
+}
+
+// historyNodeKey returns the key of the node of details within its test. Nodes
+// are keyed by ID when available so renamed nodes keep their history.
+func historyNodeKey(details *TestDetails) string {
+	if details.NodeId != "" {
+		return details.NodeId
+	}
+	return details.NodeName
+}
+
+// remove drops the history of the test and node of details, and of the test
+// once it has no nodes left.
+func (h *history) remove(details *TestDetails) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeNode(details.TestId, historyNodeKey(details))
+}
+
+// removeNode must be called with h.mu held.
+func (h *history) removeNode(testID, key string) {
+	test, ok := h.tests[testID]
+	if !ok {
+		return
+	}
+	if _, ok := test.nodes[key]; !ok {
+		return
+	}
+	delete(test.nodes, key)
+	h.nodes--
+	if len(test.nodes) == 0 {
+		delete(h.tests, testID)
+	}
+}
+
+// evictOldest drops the least recently seen node. It must be called with h.mu
+// held.
+func (h *history) evictOldest() {
+	var (
+		testID, key string
+		oldest      *nodeHistory
+	)
+	for id, test := range h.tests {
+		for k, node := range test.nodes {
+			if oldest == nil || node.lastSeen.Before(oldest.lastSeen) {
+				testID, key, oldest = id, k, node
+			}
+		}
+	}
+	if oldest != nil {
+		h.removeNode(testID, key)
+	}
+}
+
+// testSummaries returns all known tests and their nodes sorted by ID and name.
+func (h *history) testSummaries() []TestSummary {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	summaries := make([]TestSummary, 0, len(h.tests))
+	for id, test := range h.tests {
+		summary := TestSummary{
+			TestId:   id,
+			TestName: test.name,
+			LastSeen: test.lastSeen,
+			Nodes:    make([]NodeSummary, 0, len(test.nodes)),
+		}
+		for _, node := range test.nodes {
+			summary.Nodes = append(summary.Nodes, NodeSummary{
+				NodeName: node.name,
+				NodeId:   node.id,
+				LastSeen: node.lastSeen,
+			})
+		}
+		sort.Slice(summary.Nodes, func(i, j int) bool {
+			return summary.Nodes[i].NodeName < summary.Nodes[j].NodeName
+		})
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].TestId < summaries[j].TestId
+	})
+	return summaries
+}
+
+// results returns up to limit of the most recent records per node of the given
+// test, newest first. A non-positive limit returns everything retained.
+func (h *history) results(testID string, limit int) ([]NodeResults, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	test, ok := h.tests[testID]
+	if !ok {
+		return nil, false
+	}
+
+	results := make([]NodeResults, 0, len(test.nodes))
+	for _, node := range test.nodes {
+		n := len(node.records)
+		if limit > 0 && limit < n {
+			n = limit
+		}
+		records := make([]Record, 0, n)
+		for i := 1; i <= n; i++ {
+			idx := (node.next - i + len(node.records)) % len(node.records)
+			records = append(records, node.records[idx])
+		}
+		results = append(results, NodeResults{
+			NodeName: node.name,
+			NodeId:   node.id,
+			Results:  records,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].NodeName < results[j].NodeName
+	})
+	return results, true
+}
+
+// addRejection keeps the reason and a truncated copy of a rejected payload.
+func (h *history) addRejection(body []byte, err error, t time.Time) {
+	if len(body) > rejectionPayloadSize {
+		body = body[:rejectionPayloadSize]
+	}
+	rejection := Rejection{Time: t, Error: err.Error(), Payload: string(body)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.rejections) < rejectionHistorySize {
+		h.rejections = append(h.rejections, rejection)
+	} else {
+		h.rejections[h.nextRejection] = rejection
+	}
+	h.nextRejection = (h.nextRejection + 1) % rejectionHistorySize
+}
+
+// recentRejections returns the retained rejections, newest first.
+func (h *history) recentRejections() []Rejection {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	rejections := make([]Rejection, 0, len(h.rejections))
+	for i := 1; i <= len(h.rejections); i++ {
+		idx := (h.nextRejection - i + len(h.rejections)) % len(h.rejections)
+		rejections = append(rejections, h.rejections[idx])
+	}
+	return rejections
+}
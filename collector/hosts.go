@@ -0,0 +1,251 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	HostRequestsCountMetric       = "catchpoint_host_requests_count"
+	HostFailedRequestsCountMetric = "catchpoint_host_failed_requests_count"
+	HostContentSizeMetric         = "catchpoint_host_content_size"
+	HostDNSTimeMetric             = "catchpoint_host_dns_time"
+	HostConnectTimeMetric         = "catchpoint_host_connect_time"
+	HostWaitTimeMetric            = "catchpoint_host_wait_time"
+
+	HostRequestsCountDesc       = "Number of requests made to a host during the test."
+	HostFailedRequestsCountDesc = "Number of failed requests made to a host during the test."
+	HostContentSizeDesc         = "Size of the content downloaded from a host during the test in bytes."
+	HostDNSTimeDesc             = "Average time taken to resolve the domain name of a host in milliseconds."
+	HostConnectTimeDesc         = "Average time taken to connect to a host in milliseconds."
+	HostWaitTimeDesc            = "Average time from connection to receiving the first byte from a host in milliseconds."
+
+	hostLabel = "host"
+	// hostOther is the host label value of the hosts beyond the hosts limit, and
+	// of a host with that name.
+	hostOther = "other"
+)
+
+// Host rankings, which decide the hosts kept at the hosts limit.
+const (
+	HostRankRequests = "requests"
+	HostRankFailures = "failures"
+	HostRankSize     = "size"
+	HostRankWait     = "wait"
+)
+
+// hostMetrics are the per-host gauges of the host breakdown of a result. They
+// carry the labels of the series plus the host.
+type hostMetrics struct {
+	requestsCount       *seriesMetric
+	failedRequestsCount *seriesMetric
+	contentSize         *seriesMetric
+	dnsTime             *seriesMetric
+	connectTime         *seriesMetric
+	waitTime            *seriesMetric
+}
+
+func newHostMetrics(constLabels prometheus.Labels) *hostMetrics {
+	return &hostMetrics{
+		requestsCount:       newSeriesMetric(HostRequestsCountMetric, HostRequestsCountDesc, constLabels),
+		failedRequestsCount: newSeriesMetric(HostFailedRequestsCountMetric, HostFailedRequestsCountDesc, constLabels),
+		contentSize:         newSeriesMetric(HostContentSizeMetric, HostContentSizeDesc, constLabels),
+		dnsTime:             newSeriesMetric(HostDNSTimeMetric, HostDNSTimeDesc, constLabels),
+		connectTime:         newSeriesMetric(HostConnectTimeMetric, HostConnectTimeDesc, constLabels),
+		waitTime:            newSeriesMetric(HostWaitTimeMetric, HostWaitTimeDesc, constLabels),
+	}
+}
+
+// mean is an average weighted by request count.
+type mean struct {
+	sum    float64
+	weight float64
+}
+
+func (m *mean) add(value, weight float64) {
+	m.sum += value * weight
+	m.weight += weight
+}
+
+func (m *mean) merge(o mean) {
+	m.sum += o.sum
+	m.weight += o.weight
+}
+
+// hostStats is the breakdown of one host, or of several hosts merged
+// together. Absent values are not counted.
+type hostStats struct {
+	host     string
+	requests float64
+	failures float64
+	size     float64
+	dns      mean
+	connect  mean
+	wait     mean
+
+	hasRequests, hasFailures, hasSize bool
+}
+
+func (s *hostStats) merge(o *hostStats) {
+	s.requests += o.requests
+	s.failures += o.failures
+	s.size += o.size
+	s.dns.merge(o.dns)
+	s.connect.merge(o.connect)
+	s.wait.merge(o.wait)
+	s.hasRequests = s.hasRequests || o.hasRequests
+	s.hasFailures = s.hasFailures || o.hasFailures
+	s.hasSize = s.hasSize || o.hasSize
+}
+
+// rank returns the value hosts are ordered by, highest first.
+func (s *hostStats) rank(by string) float64 {
+	switch by {
+	case HostRankFailures:
+		return s.failures
+	case HostRankSize:
+		return s.size
+	case HostRankWait:
+		if s.wait.weight == 0 {
+			return 0
+		}
+		return s.wait.sum / s.wait.weight
+	}
+	return s.requests
+}
+
+// parseHost converts a host of the webhook. Values that cannot be parsed are
+// treated as absent. Averages are weighted by the request count, or by 1 if
+// there is none.
+func parseHost(h *Host) hostStats {
+	s := hostStats{host: strings.TrimSpace(h.Host)}
+	s.requests, s.hasRequests = parseHostValue(h.RequestsCount)
+	s.failures, s.hasFailures = parseHostValue(h.FailedRequestsCount)
+	s.size, s.hasSize = parseHostValue(h.Bytes)
+
+	weight := s.requests
+	if weight <= 0 {
+		weight = 1
+	}
+	for _, timing := range []struct {
+		value string
+		mean  *mean
+	}{
+		{h.Dns, &s.dns},
+		{h.Connect, &s.connect},
+		{h.Wait, &s.wait},
+	} {
+		if v, ok := parseHostValue(timing.value); ok {
+			timing.mean.add(v, weight)
+		}
+	}
+	return s
+}
+
+func parseHostValue(valueStr string) (float64, bool) {
+	value, err := parseMetricValue(valueStr)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// topHosts merges the hosts of a result by name and returns the limit hosts
+// ranking highest by rankBy, followed by the other hosts merged into one
+// named hostOther. A host named hostOther is always merged into that one, as
+// their series would clash. Hosts without a name are skipped and names are
+// truncated to maxNameLength bytes. Limits that are not positive are disabled.
+func topHosts(hosts []Host, limit int, rankBy string, maxNameLength int) []hostStats {
+	byName := make(map[string]*hostStats, len(hosts))
+	for i := range hosts {
+		s := parseHost(&hosts[i])
+		if s.host == "" {
+			continue
+		}
+		if maxNameLength > 0 && len(s.host) > maxNameLength {
+			s.host = strings.ToValidUTF8(s.host[:maxNameLength], "")
+		}
+		if merged, ok := byName[s.host]; ok {
+			merged.merge(&s)
+			continue
+		}
+		byName[s.host] = &s
+	}
+
+	other := hostStats{host: hostOther}
+	hasOther := false
+	if s, ok := byName[hostOther]; ok {
+		other.merge(s)
+		hasOther = true
+		delete(byName, hostOther)
+	}
+
+	stats := make([]hostStats, 0, len(byName)+1)
+	for _, s := range byName {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		ri, rj := stats[i].rank(rankBy), stats[j].rank(rankBy)
+		if ri != rj {
+			return ri > rj
+		}
+		return stats[i].host < stats[j].host
+	})
+	if limit > 0 && len(stats) > limit {
+		for i := limit; i < len(stats); i++ {
+			other.merge(&stats[i])
+		}
+		stats, hasOther = stats[:limit], true
+	}
+	if hasOther {
+		stats = append(stats, other)
+	}
+	return stats
+}
+
+// collectHosts emits the host metrics of the result of series.
+func (c *Collector) collectHosts(ch chan<- prometheus.Metric, series *Series) {
+	if len(series.Response.Hosts) == 0 {
+		return
+	}
+	for _, s := range topHosts(series.Response.Hosts, c.cfg.HostsLimit, c.cfg.HostsRankBy, c.cfg.LabelValueLengthLimit) {
+		labels := series.Labels.withLabels(map[string]string{hostLabel: s.host})
+		if s.hasRequests {
+			c.emitValue(ch, c.hosts.requestsCount, s.requests, labels)
+		}
+		if s.hasFailures {
+			c.emitValue(ch, c.hosts.failedRequestsCount, s.failures, labels)
+		}
+		if s.hasSize {
+			c.emitValue(ch, c.hosts.contentSize, s.size, labels)
+		}
+		for _, timing := range []struct {
+			metric *seriesMetric
+			mean   mean
+		}{
+			{c.hosts.dnsTime, s.dns},
+			{c.hosts.connectTime, s.connect},
+			{c.hosts.waitTime, s.wait},
+		} {
+			if timing.mean.weight > 0 {
+				c.emitValue(ch, timing.metric, timing.mean.sum/timing.mean.weight, labels)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+)
+
+func testHosts() []Host {
+	return []Host{
+		{Host: "www.example.com", RequestsCount: "20", FailedRequestsCount: "0", Bytes: "500000", Dns: "10", Connect: "20", Wait: "100"},
+		{Host: "cdn.example.net", RequestsCount: "30", FailedRequestsCount: "1", Bytes: "900000", Dns: "5", Connect: "8", Wait: "40"},
+		{Host: "tags.example.org", RequestsCount: "4", FailedRequestsCount: "2", Bytes: "20000", Dns: "30", Connect: "50", Wait: "900"},
+		{Host: "fonts.example.com", RequestsCount: "2", FailedRequestsCount: "0", Bytes: "60000", Dns: "12", Connect: "14", Wait: "60"},
+		{Host: "", RequestsCount: "1"},
+	}
+}
+
+func TestHostMetrics(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{
+		HostsLimit:     2,
+		RelabelConfigs: []RelabelConfig{{Action: RelabelLabelKeep, Regex: regexpPtr("test_id")}},
+	})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	resp := testResponse("1", "Paris", "100")
+	resp.Hosts = testHosts()
+	postWebhook(t, collector, resp)
+
+	// The two hosts with the most requests are kept and the others merged,
+	// with their timings averaged over their requests.
+	expected := `
+# HELP catchpoint_host_requests_count Number of requests made to a host during the test.
+# TYPE catchpoint_host_requests_count gauge
+catchpoint_host_requests_count{host="cdn.example.net",test_id="1"} 30
+catchpoint_host_requests_count{host="other",test_id="1"} 6
+catchpoint_host_requests_count{host="www.example.com",test_id="1"} 20
+# HELP catchpoint_host_failed_requests_count Number of failed requests made to a host during the test.
+# TYPE catchpoint_host_failed_requests_count gauge
+catchpoint_host_failed_requests_count{host="cdn.example.net",test_id="1"} 1
+catchpoint_host_failed_requests_count{host="other",test_id="1"} 2
+catchpoint_host_failed_requests_count{host="www.example.com",test_id="1"} 0
+# HELP catchpoint_host_wait_time Average time from connection to receiving the first byte from a host in milliseconds.
+# TYPE catchpoint_host_wait_time gauge
+catchpoint_host_wait_time{host="cdn.example.net",test_id="1"} 40
+catchpoint_host_wait_time{host="other",test_id="1"} 620
+catchpoint_host_wait_time{host="www.example.com",test_id="1"} 100
+# HELP catchpoint_series_limit_hits_total Number of times a cardinality limit was hit by limit.
+# TYPE catchpoint_series_limit_hits_total counter
+catchpoint_series_limit_hits_total{limit="hosts_per_result"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		HostRequestsCountMetric, HostFailedRequestsCountMetric, HostWaitTimeMetric, SeriesLimitHitsMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+	if count := testutil.CollectAndCount(collector, HostContentSizeMetric); count != 3 {
+		t.Errorf("expected 3 content size series, got %d", count)
+	}
+}
+
+func TestHostMetricsWithoutHosts(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{HostsLimit: 2})
+	postWebhook(t, collector, testResponse("1", "Paris", "100"))
+
+	for _, name := range []string{HostRequestsCountMetric, HostWaitTimeMetric} {
+		if count := testutil.CollectAndCount(collector, name); count != 0 {
+			t.Errorf("expected no %s series without hosts, got %d", name, count)
+		}
+	}
+}
+
+func TestHostNamedOther(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{
+		HostsLimit:     2,
+		RelabelConfigs: []RelabelConfig{{Action: RelabelLabelKeep, Regex: regexpPtr("test_id")}},
+	})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	resp := testResponse("1", "Paris", "100")
+	resp.Hosts = append(testHosts(), Host{Host: hostOther, RequestsCount: "100"})
+	postWebhook(t, collector, resp)
+
+	// The host named like the overflow bucket is merged into it instead of
+	// clashing with it.
+	if _, err := registry.Gather(); err != nil {
+		t.Fatal("failed to gather metrics:", err)
+	}
+	expected := `
+# HELP catchpoint_host_requests_count Number of requests made to a host during the test.
+# TYPE catchpoint_host_requests_count gauge
+catchpoint_host_requests_count{host="cdn.example.net",test_id="1"} 30
+catchpoint_host_requests_count{host="other",test_id="1"} 106
+catchpoint_host_requests_count{host="www.example.com",test_id="1"} 20
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), HostRequestsCountMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+}
+
+func TestTopHosts(t *testing.T) {
+	hosts := append(testHosts(), Host{Host: "cdn.example.net", RequestsCount: "10", Wait: "80"})
+	for name, tc := range map[string]struct {
+		limit    int
+		rankBy   string
+		expected []string
+	}{
+		"unlimited": {rankBy: HostRankRequests, expected: []string{"cdn.example.net", "www.example.com", "tags.example.org", "fonts.example.com"}},
+		"requests":  {limit: 1, rankBy: HostRankRequests, expected: []string{"cdn.example.net", "other"}},
+		"failures":  {limit: 1, rankBy: HostRankFailures, expected: []string{"tags.example.org", "other"}},
+		"size":      {limit: 1, rankBy: HostRankSize, expected: []string{"cdn.example.net", "other"}},
+		"wait":      {limit: 2, rankBy: HostRankWait, expected: []string{"tags.example.org", "www.example.com", "other"}},
+	} {
+		stats := topHosts(hosts, tc.limit, tc.rankBy, 0)
+		var got []string
+		for _, s := range stats {
+			got = append(got, s.host)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("%s: expected hosts %v, got %v", name, tc.expected, got)
+		}
+	}
+
+	// Repeated hosts are merged with their timings weighted by requests.
+	stats := topHosts(hosts, 0, HostRankRequests, 0)
+	if cdn := stats[0]; cdn.requests != 40 || cdn.wait.sum/cdn.wait.weight != 50 {
+		t.Errorf("expected the repeated host to be merged, got %+v", cdn)
+	}
+
+	// Truncated names that collide are merged as well.
+	stats = topHosts([]Host{{Host: "a.example.com", RequestsCount: "1"}, {Host: "a.example.net", RequestsCount: "2"}}, 0, HostRankRequests, 9)
+	if len(stats) != 1 || stats[0].host != "a.example" || stats[0].requests != 3 {
+		t.Errorf("expected truncated hosts to be merged, got %+v", stats)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+const (
+	// IdempotencyKeyHeader lets webhook senders safely resubmit a request:
+	// a repeated key returns the response of the first request.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses returned from the cache.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	idempotencyCacheSize = 10000
+)
+
+// idempotencyEntry is the response to a request with an Idempotency-Key, or a
+// reservation of the key while the request is in progress.
+type idempotencyEntry struct {
+	key     string
+	hash    [sha256.Size]byte
+	pending bool
+	code    int
+	resp    apiResponse
+	expires time.Time
+}
+
+// idempotencyCache remembers the responses to requests with an
+// Idempotency-Key for a TTL. It holds at most size entries and drops the
+// oldest ones first.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+func newIdempotencyCache(ttl time.Duration, size int) *idempotencyCache {
+	return &idempotencyCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// begin returns a copy of the unexpired entry for key. If there is none, it
+// reserves key for a request with body hash in progress. Both happen under one
+// lock, so concurrent requests with the same key are not both processed.
+func (c *idempotencyCache) begin(key string, hash [sha256.Size]byte, now time.Time) (idempotencyEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*idempotencyEntry)
+		if !now.After(entry.expires) {
+			return *entry, true
+		}
+		c.order.Remove(el)
+	}
+	c.push(&idempotencyEntry{key: key, hash: hash, pending: true, expires: now.Add(c.ttl)})
+	return idempotencyEntry{}, false
+}
+
+// finish remembers the response to the request that reserved key, or releases
+// the reservation if keep is false so the request can be retried.
+func (c *idempotencyCache) finish(key string, code int, resp apiResponse, keep bool, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		// The reservation was dropped at the size limit.
+		return
+	}
+	if !keep {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return
+	}
+	entry := el.Value.(*idempotencyEntry)
+	entry.pending = false
+	entry.code = code
+	entry.resp = resp
+	entry.expires = now.Add(c.ttl)
+	c.order.MoveToBack(el)
+}
+
+// push adds entry as the newest one and drops the oldest entries beyond the
+// size. It must be called with c.mu held.
+func (c *idempotencyCache) push(entry *idempotencyEntry) {
+	c.entries[entry.key] = c.order.PushBack(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Front()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*idempotencyEntry).key)
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+const (
+	journalPrefix = "journal-"
+	journalSuffix = ".log"
+)
+
+// errTornRecord is returned for a segment that ends in a partially written
+// record, which is what a crash during Append leaves behind.
+var errTornRecord = errors.New("torn record at end of segment")
+
+// JournalEntry is a single webhook body exactly as it was received.
+type JournalEntry struct {
+	Time time.Time
+	Body []byte
+}
+
+// journalHeader precedes every body in a journal segment. The body follows on
+// the next line and is terminated by a newline, so bodies are kept byte for
+// byte while the journal stays readable.
+type journalHeader struct {
+	Time time.Time `json:"time"`
+	Size int       `json:"size"`
+}
+
+// Journal is an append-only log of accepted webhook bodies, split into
+// numbered segments. A new segment is started once the current one would
+// exceed the maximum size and only the newest segments are retained.
+type Journal struct {
+	mu       sync.Mutex
+	dir      string
+	maxSize  int64
+	maxFiles int
+
+	file *os.File
+	size int64
+	seq  int
+}
+
+// OpenJournal opens the journal in dir, creating the directory if needed, and
+// continues appending to its newest segment.
+func OpenJournal(dir string, maxSize int64, maxFiles int) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating journal directory: %w", err)
+	}
+	segments, err := journalSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{dir: dir, maxSize: maxSize, maxFiles: maxFiles, seq: 1}
+	if len(segments) > 0 {
+		j.seq = segments[len(segments)-1]
+		if err := j.repair(); err != nil {
+			return nil, err
+		}
+	}
+	if err := j.openSegment(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// repair truncates a torn record at the end of the newest segment, so that
+// new records follow complete ones. If the segment cannot be read otherwise,
+// it is left as is and a new segment is started.
+func (j *Journal) repair() error {
+	path := j.segmentPath(j.seq)
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening journal segment: %w", err)
+	}
+	size, err := scanSegment(bufio.NewReader(f), func(JournalEntry) error { return nil })
+	f.Close()
+	switch {
+	case errors.Is(err, errTornRecord):
+		if err := os.Truncate(path, size); err != nil {
+			return fmt.Errorf("truncating journal segment: %w", err)
+		}
+	case err != nil:
+		j.seq++
+	}
+	return nil
+}
+
+func (j *Journal) segmentPath(seq int) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%s%08d%s", journalPrefix, seq, journalSuffix))
+}
+
+func (j *Journal) openSegment() error {
+	f, err := os.OpenFile(j.segmentPath(j.seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening journal segment: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("opening journal segment: %w", err)
+	}
+	j.file = f
+	j.size = info.Size()
+	return nil
+}
+
+// Append writes body to the journal, rotating segments as needed.
+func (j *Journal) Append(t time.Time, body []byte) error {
+	header, err := json.Marshal(journalHeader{Time: t, Size: len(body)})
+	if err != nil {
+		return err
+	}
+	record := make([]byte, 0, len(header)+len(body)+2)
+	record = append(record, header...)
+	record = append(record, '\n')
+	record = append(record, body...)
+	record = append(record, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return errors.New("journal is closed")
+	}
+	if j.maxSize > 0 && j.size > 0 && j.size+int64(len(record)) > j.maxSize {
+		if err := j.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := j.file.Write(record)
+	j.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("writing journal: %w", err)
+	}
+	return nil
+}
+
+// rotate starts a new segment and removes segments beyond the retention limit.
+func (j *Journal) rotate() error {
+	if err := j.file.Close(); err != nil {
+		return fmt.Errorf("closing journal segment: %w", err)
+	}
+	j.seq++
+	if err := j.openSegment(); err != nil {
+		j.file = nil
+		return err
+	}
+
+	if j.maxFiles <= 0 {
+		return nil
+	}
+	segments, err := journalSegments(j.dir)
+	if err != nil {
+		return err
+	}
+	for len(segments) > j.maxFiles {
+		if err := os.Remove(j.segmentPath(segments[0])); err != nil {
+			return fmt.Errorf("removing journal segment: %w", err)
+		}
+		segments = segments[1:]
+	}
+	return nil
+}
+
+// Close syncs and closes the current segment.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Sync()
+	if closeErr := j.file.Close(); err == nil {
+		err = closeErr
+	}
+	j.file = nil
+	return err
+}
+
+// journalSegments returns the sequence numbers of all segments in dir in order.
+func journalSegments(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading journal directory: %w", err)
+	}
+	var segments []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, journalPrefix) || !strings.HasSuffix(name, journalSuffix) {
+			continue
+		}
+		seq, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, journalPrefix), journalSuffix))
+		if err != nil {
+			continue
+		}
+		segments = append(segments, seq)
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+// ReadJournal calls fn for every entry in the journal in dir, oldest first.
+// Reading stops at the first error returned by fn. A torn record at the end of
+// a segment is skipped with a warning.
+func ReadJournal(logger log.Logger, dir string, fn func(JournalEntry) error) error {
+	segments, err := journalSegments(dir)
+	if err != nil {
+		return err
+	}
+	j := &Journal{dir: dir}
+	for _, seq := range segments {
+		if err := readSegment(logger, j.segmentPath(seq), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSegment(logger log.Logger, path string, fn func(JournalEntry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening journal segment: %w", err)
+	}
+	defer f.Close()
+
+	var fnErr error
+	_, err = scanSegment(bufio.NewReader(f), func(entry JournalEntry) error {
+		fnErr = fn(entry)
+		return fnErr
+	})
+	switch {
+	case fnErr != nil:
+		return fnErr
+	case errors.Is(err, errTornRecord):
+		logger.Log("level", "warn", "msg", "Skipping torn record at the end of journal segment", "path", path)
+		return nil
+	case err != nil:
+		return fmt.Errorf("reading journal segment %s: %w", path, err)
+	}
+	return nil
+}
+
+// scanSegment calls fn for every record read from r and returns the size of
+// the complete records read.
+func scanSegment(r *bufio.Reader, fn func(JournalEntry) error) (int64, error) {
+	var size int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) == 0 {
+				return size, nil
+			}
+			return size, errTornRecord
+		}
+		if err != nil {
+			return size, err
+		}
+
+		var header journalHeader
+		if err := json.Unmarshal(line, &header); err != nil {
+			return size, fmt.Errorf("invalid header: %w", err)
+		}
+		if header.Size < 0 {
+			return size, fmt.Errorf("invalid header: negative size %d", header.Size)
+		}
+		body := make([]byte, header.Size+1)
+		if _, err := io.ReadFull(r, body); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return size, errTornRecord
+		} else if err != nil {
+			return size, err
+		}
+		if body[header.Size] != '\n' {
+			return size, errors.New("entry is not terminated by a newline")
+		}
+		size += int64(len(line) + len(body))
+		if err := fn(JournalEntry{Time: header.Time, Body: body[:header.Size]}); err != nil {
+			return size, err
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/promlog"
+)
+
+func TestJournalRotationAndRetention(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	dir := t.TempDir()
+	journal, err := OpenJournal(dir, 200, 2)
+	if err != nil {
+		t.Fatal("failed to open journal:", err)
+	}
+
+	bodies := []string{
+		"{\n  \"first\": 1\n}",
+		`{"second": "` + strings.Repeat("x", 100) + `"}`,
+		`{"third": 3}`,
+		`{"fourth": 4}`,
+	}
+	for _, body := range bodies {
+		if err := journal.Append(time.Now(), []byte(body)); err != nil {
+			t.Fatal("failed to append to journal:", err)
+		}
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatal("failed to close journal:", err)
+	}
+
+	segments, err := journalSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("expected 2 retained segments, got %v", segments)
+	}
+
+	var replayed []string
+	err = ReadJournal(logger, dir, func(entry JournalEntry) error {
+		replayed = append(replayed, string(entry.Body))
+		return nil
+	})
+	if err != nil {
+		t.Fatal("failed to read journal:", err)
+	}
+	if len(replayed) == 0 || replayed[len(replayed)-1] != bodies[3] {
+		t.Errorf("expected the newest bodies to be retained, got %q", replayed)
+	}
+
+	// Reopening continues the newest segment.
+	journal, err = OpenJournal(dir, 200, 2)
+	if err != nil {
+		t.Fatal("failed to reopen journal:", err)
+	}
+	defer journal.Close()
+	if journal.seq != segments[1] {
+		t.Errorf("expected to continue segment %d, got %d", segments[1], journal.seq)
+	}
+}
+
+func TestJournalReplay(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	dir := t.TempDir()
+	journal, err := OpenJournal(dir, 0, 0)
+	if err != nil {
+		t.Fatal("failed to open journal:", err)
+	}
+
+	source := NewCollector(logger, &Config{})
+	source.SetJournal(journal)
+	postWebhook(t, source, testResponse("1", "Bangalore", "100"))
+	source.HandleWebhook(httptest.NewRecorder(), httptest.NewRequest("POST", "/webhook", strings.NewReader("not json")))
+	postWebhook(t, source, testResponse("1", "Paris", "200"))
+	journal.Close()
+
+	target := NewCollector(logger, &Config{})
+	err = ReadJournal(logger, dir, func(entry JournalEntry) error {
+		_, err := target.Ingest(entry.Body, entry.Time)
+		return err
+	})
+	if err != nil {
+		t.Fatal("failed to replay journal:", err)
+	}
+
+	if got, want := len(target.store.list(time.Now())), 2; got != want {
+		t.Errorf("expected %d replayed series, got %d", want, got)
+	}
+	if got := target.webhooksRejected.Load(); got != 0 {
+		t.Errorf("expected rejected bodies not to be journaled, got %d rejections", got)
+	}
+}
+
+func TestJournalTornRecord(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	// A crash during Append leaves a partial header or body behind.
+	for name, torn := range map[string]string{
+		"header": `{"time":"2024-05-02T`,
+		"body":   "{\"time\":\"2024-05-02T21:20:00Z\",\"size\":13}\n{\"sec",
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			journal, err := OpenJournal(dir, 0, 0)
+			if err != nil {
+				t.Fatal("failed to open journal:", err)
+			}
+			if err := journal.Append(time.Now(), []byte(`{"first": 1}`)); err != nil {
+				t.Fatal("failed to append to journal:", err)
+			}
+			journal.file.WriteString(torn)
+			journal.Close()
+
+			readBodies := func() []string {
+				var bodies []string
+				err := ReadJournal(logger, dir, func(entry JournalEntry) error {
+					bodies = append(bodies, string(entry.Body))
+					return nil
+				})
+				if err != nil {
+					t.Fatal("failed to read journal:", err)
+				}
+				return bodies
+			}
+			if bodies := readBodies(); len(bodies) != 1 {
+				t.Errorf("expected the complete record to be read, got %q", bodies)
+			}
+
+			// Reopening truncates the partial record, so records appended
+			// afterwards can be read.
+			journal, err = OpenJournal(dir, 0, 0)
+			if err != nil {
+				t.Fatal("failed to reopen journal:", err)
+			}
+			if err := journal.Append(time.Now(), []byte(`{"second": 2}`)); err != nil {
+				t.Fatal("failed to append to journal:", err)
+			}
+			journal.Close()
+			if bodies := readBodies(); len(bodies) != 2 || bodies[1] != `{"second": 2}` {
+				t.Errorf("expected the records around the torn one to be read, got %q", bodies)
+			}
+		})
+	}
+}
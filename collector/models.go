@@ -14,6 +14,8 @@
 
 package collector
 
+import "time"
+
 // TestDetails represents detailed information about a test run.
 type TestDetails struct {
 	TestName      string `json:"TestName"`
@@ -28,57 +30,247 @@ type TestDetails struct {
 	ClientId      string `json:"ClientId"`
 }
 
-// Summary represents the 44 aggregated results of a test run.
+// Field returns the value of the field with the given JSON name.
+func (d *TestDetails) Field(name string) (string, bool) {
+	switch name {
+	case "TestName":
+		return d.TestName, true
+	case "TypeId":
+		return d.TypeId, true
+	case "MonitorTypeId":
+		return d.MonitorTypeId, true
+	case "TestId":
+		return d.TestId, true
+	case "ReportWindow":
+		return d.ReportWindow, true
+	case "NodeId":
+		return d.NodeId, true
+	case "NodeName":
+		return d.NodeName, true
+	case "Asn":
+		return d.Asn, true
+	case "DivisionId":
+		return d.DivisionId, true
+	case "ClientId":
+		return d.ClientId, true
+	}
+	return "", false
+}
+
+// ReportTime returns the start of the report window, if ReportWindow holds a
+// Catchpoint timestamp.
+func (d *TestDetails) ReportTime() (time.Time, bool) {
+	return parseCatchpointTime(d.ReportWindow)
+}
+
+// Summary represents the 50 aggregated results of a test run. The Core Web
+// Vitals and paint metrics, from FirstContentfulPaint to SpeedIndex, are only
+// sent by Chrome tests. CumulativeLayoutShift is a unitless score.
 type Summary struct {
-	Timestamp           string `json:"Timestamp"`
-	TotalTime           string `json:"TotalTime"`
-	Connect             string `json:"Connect"`
+	Timestamp              string `json:"Timestamp"`
+	TotalTime              string `json:"TotalTime"`
+	Connect                string `json:"Connect"`
+	Dns                    string `json:"Dns"`
+	ContentLoad            string `json:"ContentLoad"`
+	Load                   string `json:"Load"`
+	Redirect               string `json:"Redirect"`
+	SSL                    string `json:"SSL"`
+	Wait                   string `json:"Wait"`
+	Client                 string `json:"Client"`
+	DocumentComplete       string `json:"DocumentComplete"`
+	RenderStart            string `json:"RenderStart"`
+	FirstContentfulPaint   string `json:"FirstContentfulPaint"`
+	LargestContentfulPaint string `json:"LargestContentfulPaint"`
+	CumulativeLayoutShift  string `json:"CumulativeLayoutShift"`
+	TotalBlockingTime      string `json:"TotalBlockingTime"`
+	TimeToInteractive      string `json:"TimeToInteractive"`
+	SpeedIndex             string `json:"SpeedIndex"`
+	ResponseContent        string `json:"ResponseContent"`
+	ResponseHeaders        string `json:"ResponseHeaders"`
+	TotalContent           string `json:"TotalContent"`
+	TotalHeaders           string `json:"TotalHeaders"`
+	AnyError               string `json:"AnyError"`
+	ConnectionError        string `json:"ConnectionError"`
+	DNSError               string `json:"DNSError"`
+	LoadError              string `json:"LoadError"`
+	TimeoutError           string `json:"TimeoutError"`
+	TransactionError       string `json:"TransactionError"`
+	ErrorObjectsLoaded     string `json:"ErrorObjectsLoaded"`
+	ImageContentType       string `json:"ImageContentType"`
+	ScriptContentType      string `json:"ScriptContentType"`
+	HTMLContentType        string `json:"HTMLContentType"`
+	CSSContentType         string `json:"CSSContentType"`
+	FontContentType        string `json:"FontContentType"`
+	MediaContentType       string `json:"MediaContentType"`
+	XMLContentType         string `json:"XMLContentType"`
+	OtherContentType       string `json:"OtherContentType"`
+	ConnectionsCount       string `json:"ConnectionsCount"`
+	HostsCount             string `json:"HostsCount"`
+	FailedRequestsCount    string `json:"FailedRequestsCount"`
+	RequestsCount          string `json:"RequestsCount"`
+	RedirectionsCount      string `json:"RedirectionsCount"`
+	CachedCount            string `json:"CachedCount"`
+	ImageCount             string `json:"ImageCount"`
+	ScriptCount            string `json:"ScriptCount"`
+	HTMLCount              string `json:"HTMLCount"`
+	CSSCount               string `json:"CSSCount"`
+	FontCount              string `json:"FontCount"`
+	XMLCount               string `json:"XMLCount"`
+	MediaCount             string `json:"MediaCount"`
+	TracepointsCount       string `json:"TracepointsCount"`
+}
+
+// Step represents the results of one step of a transaction test. Step is
+// the step number, starting at 1.
+type Step struct {
+	Step             string `json:"Step"`
+	Name             string `json:"Name"`
+	URL              string `json:"URL"`
+	TotalTime        string `json:"TotalTime"`
+	Connect          string `json:"Connect"`
+	Dns              string `json:"Dns"`
+	SSL              string `json:"SSL"`
+	Wait             string `json:"Wait"`
+	Load             string `json:"Load"`
+	ContentLoad      string `json:"ContentLoad"`
+	DocumentComplete string `json:"DocumentComplete"`
+	RenderStart      string `json:"RenderStart"`
+	AnyError         string `json:"AnyError"`
+	ConnectionError  string `json:"ConnectionError"`
+	DNSError         string `json:"DNSError"`
+	LoadError        string `json:"LoadError"`
+	TimeoutError     string `json:"TimeoutError"`
+	TransactionError string `json:"TransactionError"`
+}
+
+// Host represents the requests a test made to one host. Dns, Connect and
+// Wait are averages over the requests.
+type Host struct {
+	Host                string `json:"Host"`
+	RequestsCount       string `json:"RequestsCount"`
+	FailedRequestsCount string `json:"FailedRequestsCount"`
+	Bytes               string `json:"Bytes"`
 	Dns                 string `json:"Dns"`
-	ContentLoad         string `json:"ContentLoad"`
-	Load                string `json:"Load"`
-	Redirect            string `json:"Redirect"`
-	SSL                 string `json:"SSL"`
+	Connect             string `json:"Connect"`
 	Wait                string `json:"Wait"`
-	Client              string `json:"Client"`
-	DocumentComplete    string `json:"DocumentComplete"`
-	RenderStart         string `json:"RenderStart"`
-	ResponseContent     string `json:"ResponseContent"`
-	ResponseHeaders     string `json:"ResponseHeaders"`
-	TotalContent        string `json:"TotalContent"`
-	TotalHeaders        string `json:"TotalHeaders"`
-	AnyError            string `json:"AnyError"`
-	ConnectionError     string `json:"ConnectionError"`
-	DNSError            string `json:"DNSError"`
-	LoadError           string `json:"LoadError"`
-	TimeoutError        string `json:"TimeoutError"`
-	TransactionError    string `json:"TransactionError"`
-	ErrorObjectsLoaded  string `json:"ErrorObjectsLoaded"`
-	ImageContentType    string `json:"ImageContentType"`
-	ScriptContentType   string `json:"ScriptContentType"`
-	HTMLContentType     string `json:"HTMLContentType"`
-	CSSContentType      string `json:"CSSContentType"`
-	FontContentType     string `json:"FontContentType"`
-	MediaContentType    string `json:"MediaContentType"`
-	XMLContentType      string `json:"XMLContentType"`
-	OtherContentType    string `json:"OtherContentType"`
-	ConnectionsCount    string `json:"ConnectionsCount"`
-	HostsCount          string `json:"HostsCount"`
-	FailedRequestsCount string `json:"FailedRequestsCount"`
-	RequestsCount       string `json:"RequestsCount"`
-	RedirectionsCount   string `json:"RedirectionsCount"`
-	CachedCount         string `json:"CachedCount"`
-	ImageCount          string `json:"ImageCount"`
-	ScriptCount         string `json:"ScriptCount"`
-	HTMLCount           string `json:"HTMLCount"`
-	CSSCount            string `json:"CSSCount"`
-	FontCount           string `json:"FontCount"`
-	XMLCount            string `json:"XMLCount"`
-	MediaCount          string `json:"MediaCount"`
-	TracepointsCount    string `json:"TracepointsCount"`
-}
-
-// Response represents the full response structure from the API.
+}
+
+// PingResult represents the results of a Ping test. Times are in
+// milliseconds and PacketLoss is a percentage.
+type PingResult struct {
+	RoundTripTime    string `json:"RoundTripTime"`
+	MinRoundTripTime string `json:"MinRoundTripTime"`
+	MaxRoundTripTime string `json:"MaxRoundTripTime"`
+	PacketLoss       string `json:"PacketLoss"`
+	Jitter           string `json:"Jitter"`
+}
+
+// DNSResult represents the results of a DNS test. ResponseCode is the DNS
+// RCODE, as a number or a name like NXDOMAIN.
+type DNSResult struct {
+	ResolutionTime string `json:"ResolutionTime"`
+	ResponseCode   string `json:"ResponseCode"`
+	RecordsCount   string `json:"RecordsCount"`
+}
+
+// TracerouteResult represents the results of a Traceroute test.
+type TracerouteResult struct {
+	HopCount           string `json:"HopCount"`
+	DestinationReached string `json:"DestinationReached"`
+	RoundTripTime      string `json:"RoundTripTime"`
+}
+
+// SSLResult represents the results of an SSL certificate test.
+// CertificateExpiry is a Catchpoint timestamp. DaysToExpiry is only used when
+// there is no CertificateExpiry.
+type SSLResult struct {
+	CertificateExpiry string `json:"CertificateExpiry"`
+	DaysToExpiry      string `json:"DaysToExpiry"`
+	CertificateValid  string `json:"CertificateValid"`
+}
+
+// APIResult represents the results of an API test in addition to its
+// Summary.
+type APIResult struct {
+	ResponseCode          string `json:"ResponseCode"`
+	FailedAssertionsCount string `json:"FailedAssertionsCount"`
+}
+
+// Response represents the full response structure from the API. Steps is
+// only sent for transaction tests and Hosts only if the template includes the
+// host breakdown. Ping, DNS, Traceroute, SSL and API hold the results of the
+// other test types, see DefaultTestTypes.
 type Response struct {
+	TestDetails TestDetails       `json:"TestDetails"`
+	Summary     Summary           `json:"Summary"`
+	Steps       []Step            `json:"Steps,omitempty"`
+	Hosts       []Host            `json:"Hosts,omitempty"`
+	Ping        *PingResult       `json:"Ping,omitempty"`
+	DNS         *DNSResult        `json:"DNS,omitempty"`
+	Traceroute  *TracerouteResult `json:"Traceroute,omitempty"`
+	SSL         *SSLResult        `json:"SSL,omitempty"`
+	API         *APIResult        `json:"API,omitempty"`
+}
+
+// Time returns the time of the test run, if Timestamp holds a Catchpoint
+// timestamp.
+func (s *Summary) Time() (time.Time, bool) {
+	return parseCatchpointTime(s.Timestamp)
+}
+
+// Time returns the time used to order results of the same test and node: the
+// run timestamp, or the start of the report window if there is none.
+func (r *Response) Time() (time.Time, bool) {
+	if t, ok := r.Summary.Time(); ok {
+		return t, true
+	}
+	return r.TestDetails.ReportTime()
+}
+
+// parseCatchpointTime parses UTC timestamps of the form yyyyMMddHHmm with
+// optional seconds and milliseconds, e.g. 20240502212044798.
+func parseCatchpointTime(s string) (time.Time, bool) {
+	var (
+		t   time.Time
+		err error
+	)
+	switch len(s) {
+	case 12:
+		t, err = time.Parse("200601021504", s)
+	case 14:
+		t, err = time.Parse("20060102150405", s)
+	case 17:
+		t, err = time.Parse("20060102150405.000", s[:14]+"."+s[14:])
+	default:
+		return time.Time{}, false
+	}
+	return t, err == nil
+}
+
+// Alert levels of an Alert, compared case-insensitively. AlertLevelImproved
+// notifies that a triggered alert cleared.
+const (
+	AlertLevelWarning  = "warning"
+	AlertLevelCritical = "critical"
+	AlertLevelImproved = "improved"
+)
+
+// Alert describes a Catchpoint alert notification.
+type Alert struct {
+	TypeId    string `json:"TypeId"`
+	Type      string `json:"Type"`
+	Level     string `json:"Level"`
+	Timestamp string `json:"Timestamp"`
+}
+
+// AlertResponse represents the payload of an alert webhook.
+type AlertResponse struct {
 	TestDetails TestDetails `json:"TestDetails"`
-	Summary     Summary     `json:"Summary"`
+	Alert       Alert       `json:"Alert"`
+}
+
+// Time returns the time the alert was triggered or cleared, if Timestamp
+// holds a Catchpoint timestamp.
+func (a *Alert) Time() (time.Time, bool) {
+	return parseCatchpointTime(a.Timestamp)
 }
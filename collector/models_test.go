@@ -0,0 +1,44 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResponseTime(t *testing.T) {
+	for name, tc := range map[string]struct {
+		timestamp    string
+		reportWindow string
+		expected     time.Time
+		ok           bool
+	}{
+		"milliseconds":  {timestamp: "20240502212044798", expected: time.Date(2024, 5, 2, 21, 20, 44, 798e6, time.UTC), ok: true},
+		"seconds":       {timestamp: "20240502212044", expected: time.Date(2024, 5, 2, 21, 20, 44, 0, time.UTC), ok: true},
+		"report window": {reportWindow: "202405022120", expected: time.Date(2024, 5, 2, 21, 20, 0, 0, time.UTC), ok: true},
+		"invalid":       {timestamp: "2024-05-02", reportWindow: "123123123210000000"},
+		"empty":         {},
+	} {
+		resp := Response{
+			TestDetails: TestDetails{ReportWindow: tc.reportWindow},
+			Summary:     Summary{Timestamp: tc.timestamp},
+		}
+		got, ok := resp.Time()
+		if ok != tc.ok || !got.Equal(tc.expected) {
+			t.Errorf("%s: expected %v, %t, got %v, %t", name, tc.expected, tc.ok, got, ok)
+		}
+	}
+}
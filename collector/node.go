@@ -0,0 +1,148 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Node labels
+var (
+	nodeCityLabel      = "node_city"
+	nodeCountryLabel   = "node_country"
+	nodeISPLabel       = "node_isp"
+	nodeLatitudeLabel  = "node_latitude"
+	nodeLongitudeLabel = "node_longitude"
+	nodeRegionLabel    = "node_region"
+)
+
+// nodeNameRegexp matches Catchpoint node names like
+// "Bangalore, IN - Tata Teleservices".
+var nodeNameRegexp = regexp.MustCompile(`^\s*(.+?)\s*,\s*([A-Za-z]{2})\s+-\s+(.+?)\s*$`)
+
+// NodeName is a Catchpoint node name split into its parts.
+type NodeName struct {
+	City    string
+	Country string
+	ISP     string
+}
+
+// ParseNodeName splits a node name of the form "City, CC - Provider".
+func ParseNodeName(name string) (NodeName, bool) {
+	m := nodeNameRegexp.FindStringSubmatch(name)
+	if m == nil {
+		return NodeName{}, false
+	}
+	return NodeName{City: m[1], Country: strings.ToUpper(m[2]), ISP: m[3]}, true
+}
+
+// NodeLocation is the location of a Catchpoint node from the lookup file.
+type NodeLocation struct {
+	NodeID    string  `json:"node_id"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Region    string  `json:"region"`
+}
+
+// NodeLookup maps NodeId values to node locations.
+type NodeLookup map[string]NodeLocation
+
+// LoadNodeLookup reads node locations from a JSON file holding an array of
+// NodeLocation objects or, for any other extension, from a CSV file with the
+// header node_id,latitude,longitude,region.
+func LoadNodeLookup(path string) (NodeLookup, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening node lookup file: %w", err)
+	}
+	defer f.Close()
+
+	var locations []NodeLocation
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.NewDecoder(f).Decode(&locations)
+	} else {
+		locations, err = readNodeLocationsCSV(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing node lookup file: %w", err)
+	}
+
+	lookup := make(NodeLookup, len(locations))
+	for _, l := range locations {
+		if l.NodeID == "" {
+			return nil, errors.New("parsing node lookup file: node_id is required")
+		}
+		if _, ok := lookup[l.NodeID]; ok {
+			return nil, fmt.Errorf("parsing node lookup file: duplicate node_id %q", l.NodeID)
+		}
+		lookup[l.NodeID] = l
+	}
+	return lookup, nil
+}
+
+func readNodeLocationsCSV(r io.Reader) ([]NodeLocation, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := []string{"node_id", "latitude", "longitude", "region"}
+	if strings.Join(records[0], ",") != strings.Join(header, ",") {
+		return nil, fmt.Errorf("expected header %q", strings.Join(header, ","))
+	}
+
+	locations := make([]NodeLocation, 0, len(records)-1)
+	for i, record := range records[1:] {
+		lat, err := strconv.ParseFloat(record[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid latitude: %w", i+2, err)
+		}
+		lon, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid longitude: %w", i+2, err)
+		}
+		locations = append(locations, NodeLocation{NodeID: record[0], Latitude: lat, Longitude: lon, Region: record[3]})
+	}
+	return locations, nil
+}
+
+// addNodeLabels adds the parsed node name and the looked up location to
+// labels. Names that cannot be parsed get no name labels.
+func (c *Collector) addNodeLabels(labels map[string]string, details *TestDetails) {
+	if c.cfg.ParseNodeNames {
+		if name, ok := ParseNodeName(details.NodeName); ok {
+			labels[nodeCityLabel] = name.City
+			labels[nodeCountryLabel] = name.Country
+			labels[nodeISPLabel] = name.ISP
+		}
+	}
+	if l, ok := c.cfg.NodeLookup[details.NodeId]; ok {
+		labels[nodeLatitudeLabel] = strconv.FormatFloat(l.Latitude, 'f', -1, 64)
+		labels[nodeLongitudeLabel] = strconv.FormatFloat(l.Longitude, 'f', -1, 64)
+		labels[nodeRegionLabel] = l.Region
+	}
+}
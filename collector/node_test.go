@@ -0,0 +1,180 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+)
+
+func TestParseNodeName(t *testing.T) {
+	for name, expected := range map[string]*NodeName{
+		"Bangalore, IN - Tata Teleservices": {City: "Bangalore", Country: "IN", ISP: "Tata Teleservices"},
+		"New York, us - Level3":             {City: "New York", Country: "US", ISP: "Level3"},
+		"Sao Paulo, BR - Cloud - AWS":       {City: "Sao Paulo", Country: "BR", ISP: "Cloud - AWS"},
+		"Paris":                             nil,
+		"Paris - Orange":                    nil,
+		"":                                  nil,
+	} {
+		parsed, ok := ParseNodeName(name)
+		if expected == nil {
+			if ok {
+				t.Errorf("%q: expected no match, got %+v", name, parsed)
+			}
+			continue
+		}
+		if !ok || parsed != *expected {
+			t.Errorf("%q: expected %+v, got %+v", name, *expected, parsed)
+		}
+	}
+}
+
+func TestLoadNodeLookup(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"nodes.csv":  "node_id,latitude,longitude,region\n11,12.97,77.59,APAC\n12,48.85,2.35,EMEA\n",
+		"nodes.json": `[{"node_id":"11","latitude":12.97,"longitude":77.59,"region":"APAC"},{"node_id":"12","latitude":48.85,"longitude":2.35,"region":"EMEA"}]`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal("failed to write lookup file:", err)
+		}
+		lookup, err := LoadNodeLookup(path)
+		if err != nil {
+			t.Errorf("%s: failed to load: %v", name, err)
+			continue
+		}
+		if len(lookup) != 2 || lookup["12"] != (NodeLocation{NodeID: "12", Latitude: 48.85, Longitude: 2.35, Region: "EMEA"}) {
+			t.Errorf("%s: unexpected lookup %+v", name, lookup)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"bad-header.csv": "id,lat,lon,region\n11,1,2,APAC\n",
+		"bad-lat.csv":    "node_id,latitude,longitude,region\n11,north,2,APAC\n",
+		"duplicate.csv":  "node_id,latitude,longitude,region\n11,1,2,APAC\n11,3,4,EMEA\n",
+		"no-id.json":     `[{"latitude":1,"longitude":2}]`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal("failed to write lookup file:", err)
+		}
+		if _, err := LoadNodeLookup(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNodeLabels(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{
+		ParseNodeNames: true,
+		NodeLookup:     NodeLookup{"11": {NodeID: "11", Latitude: 12.97, Longitude: 77.59, Region: "APAC"}},
+	})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	bangalore := testResponse("1", "Bangalore, IN - Tata Teleservices", "100")
+	bangalore.TestDetails.NodeId = "11"
+	postWebhook(t, collector, bangalore)
+	postWebhook(t, collector, testResponse("2", "Paris", "200"))
+
+	expected := `
+# HELP catchpoint_node_name_parse_errors_total Number of results whose node name could not be parsed into city, country and ISP.
+# TYPE catchpoint_node_name_parse_errors_total counter
+catchpoint_node_name_parse_errors_total 1
+# HELP catchpoint_total_time Total time it took to load the webpage in milliseconds.
+# TYPE catchpoint_total_time gauge
+catchpoint_total_time{asn="",client_id="",division_id="",monitor_type_id="",node_city="Bangalore",node_country="IN",node_id="11",node_isp="Tata Teleservices",node_latitude="12.97",node_longitude="77.59",node_name="Bangalore, IN - Tata Teleservices",node_region="APAC",test_id="1",test_name="My Homepage",type_id=""} 100
+catchpoint_total_time{asn="",client_id="",division_id="",monitor_type_id="",node_id="Paris",node_name="Paris",test_id="2",test_name="My Homepage",type_id=""} 200
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), TotalTimeMetric, NodeNameParseErrorsMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+}
+
+func TestNodeRename(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{HistorySize: 10})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	resp := testResponse("1", "Bangalore", "100")
+	resp.TestDetails.NodeId = "11"
+	postWebhook(t, collector, resp)
+	resp.TestDetails.NodeName = "Bengaluru"
+	resp.Summary.TotalTime = "200"
+	postWebhook(t, collector, resp)
+
+	expected := `
+# HELP catchpoint_node_info Current name of a Catchpoint node, with value 1.
+# TYPE catchpoint_node_info gauge
+catchpoint_node_info{node_id="11",node_name="Bengaluru"} 1
+# HELP catchpoint_total_time Total time it took to load the webpage in milliseconds.
+# TYPE catchpoint_total_time gauge
+catchpoint_total_time{asn="",client_id="",division_id="",monitor_type_id="",node_id="11",node_name="Bengaluru",test_id="1",test_name="My Homepage",type_id=""} 200
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), TotalTimeMetric, NodeInfoMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+
+	results, _ := collector.history.results("1", 0)
+	if len(results) != 1 || results[0].NodeName != "Bengaluru" || len(results[0].Results) != 2 {
+		t.Errorf("expected the renamed node to keep its history, got %+v", results)
+	}
+}
+
+func TestDropNodeNameLabel(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{
+		DropNodeNameLabel: true,
+		RelabelConfigs: []RelabelConfig{{
+			SourceLabels: []string{"node_name"},
+			TargetLabel:  "probe_location",
+		}},
+	})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	resp := testResponse("1", "Bangalore", "100")
+	resp.TestDetails.NodeId = "11"
+	postWebhook(t, collector, resp)
+	resp.TestDetails.NodeName = "Bengaluru"
+	resp.Summary.TotalTime = "200"
+	postWebhook(t, collector, resp)
+
+	// Labels derived from node_name are kept.
+	expected := `
+# HELP catchpoint_total_time Total time it took to load the webpage in milliseconds.
+# TYPE catchpoint_total_time gauge
+catchpoint_total_time{asn="",client_id="",division_id="",monitor_type_id="",node_id="11",probe_location="Bengaluru",test_id="1",test_name="My Homepage",type_id=""} 200
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), TotalTimeMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const snapshotVersion = 1
+
+// snapshot is the on-disk representation of the series store.
+type snapshot struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	Series  []Series  `json:"series"`
+}
+
+// SaveState atomically writes all live series to path. The snapshot is written
+// to a temporary file in the same directory which is then renamed over path.
+func (c *Collector) SaveState(path string) error {
+	now := time.Now()
+	data, err := json.Marshal(snapshot{
+		Version: snapshotVersion,
+		Time:    now,
+		Series:  c.store.list(now),
+	})
+	if err != nil {
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("syncing snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("renaming snapshot: %w", err)
+	}
+
+	// Persist the rename itself. Not every platform supports syncing a
+	// directory, so failures here are not fatal.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// LoadState restores series from a snapshot written by SaveState. Series older
+// than the configured TTL are skipped. A missing file is not an error.
+func (c *Collector) LoadState(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decoding snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+
+	restored := c.store.restore(snap.Series, time.Now())
+	for _, series := range restored {
+		c.history.add(series.Response, series.UpdatedAt)
+	}
+	c.logger.Log("level", "info", "msg", "Restored state from snapshot", "path", path, "series", len(restored), "snapshot_time", snap.Time)
+	return nil
+}
+
+// PersistState snapshots the series store to path every interval until ctx is
+// done, then writes a final snapshot.
+func (c *Collector) PersistState(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.SaveState(path); err != nil {
+				c.logger.Log("level", "error", "msg", "Failed to save state", "path", path, "error", err)
+			}
+		case <-ctx.Done():
+			if err := c.SaveState(path); err != nil {
+				c.logger.Log("level", "error", "msg", "Failed to save state on shutdown", "path", path, "error", err)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/promlog"
+)
+
+func TestSaveAndLoadState(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	source := NewCollector(logger, &Config{})
+	postWebhook(t, source, testResponse("1", "Bangalore", "100"))
+	postWebhook(t, source, testResponse("2", "Paris", "200"))
+	old := testResponse("3", "Paris", "300")
+	labels, _ := source.seriesLabels(&old.TestDetails)
+	source.store.set(old, labels, time.Now().Add(-2*time.Hour))
+	if err := source.SaveState(path); err != nil {
+		t.Fatal("failed to save state:", err)
+	}
+
+	target := NewCollector(logger, &Config{SeriesTTL: time.Hour, HistorySize: 1})
+	if err := target.LoadState(path); err != nil {
+		t.Fatal("failed to load state:", err)
+	}
+
+	series := target.store.list(time.Now())
+	if len(series) != 2 {
+		t.Fatalf("expected 2 unexpired series, got %d", len(series))
+	}
+	if series[0].Response.Summary.TotalTime != "100" || series[1].Response.TestDetails.NodeName != "Paris" {
+		t.Errorf("unexpected restored series: %+v", series)
+	}
+	if _, ok := target.history.results("1", 0); !ok {
+		t.Error("expected restored series to be added to the history")
+	}
+}
+
+func TestLoadStateMissingFile(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{})
+	if err := collector.LoadState(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("expected no error for a missing snapshot, got %v", err)
+	}
+}
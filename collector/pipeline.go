@@ -0,0 +1,141 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// OutcomeQueued is the webhook response outcome of results queued for
+	// processing by the ingestion workers.
+	OutcomeQueued = "queued"
+
+	IngestQueueLengthMetric   = "catchpoint_ingest_queue_length"
+	IngestQueueCapacityMetric = "catchpoint_ingest_queue_capacity"
+	IngestQueueFullMetric     = "catchpoint_ingest_queue_full_total"
+	IngestLatencyMetric       = "catchpoint_ingest_latency_seconds"
+
+	IngestQueueLengthDesc   = "Number of decoded webhooks waiting for an ingestion worker."
+	IngestQueueCapacityDesc = "Maximum number of decoded webhooks waiting for an ingestion worker."
+	IngestQueueFullDesc     = "Number of webhooks rejected with 429 because the ingestion queue was full."
+	IngestLatencyDesc       = "Time from queuing a decoded webhook until it was processed in seconds."
+)
+
+var (
+	errQueueFull   = errors.New("ingestion queue is full")
+	errQueueClosed = errors.New("ingestion queue is closed")
+)
+
+// ingestJob is a decoded webhook waiting to be processed.
+type ingestJob struct {
+	resp       *Response
+	body       []byte
+	receivedAt time.Time
+	replicated bool
+	queuedAt   time.Time
+}
+
+// ingestQueue is a bounded queue of decoded webhooks processed by a pool of
+// workers, so slow processing does not block webhook senders.
+type ingestQueue struct {
+	mu     sync.RWMutex
+	closed bool
+	jobs   chan *ingestJob
+	wg     sync.WaitGroup
+
+	full            atomic.Uint64
+	latency         prometheus.Histogram
+	lengthMetric    *prometheus.Desc
+	capacityMetric  *prometheus.Desc
+	queueFullMetric *prometheus.Desc
+}
+
+func newIngestQueue(c *Collector, workers, size int) *ingestQueue {
+	q := &ingestQueue{
+		jobs: make(chan *ingestJob, size),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:        IngestLatencyMetric,
+			Help:        IngestLatencyDesc,
+			ConstLabels: c.cfg.Labels,
+			Buckets:     prometheus.DefBuckets,
+		}),
+		lengthMetric:    prometheus.NewDesc(IngestQueueLengthMetric, IngestQueueLengthDesc, nil, c.cfg.Labels),
+		capacityMetric:  prometheus.NewDesc(IngestQueueCapacityMetric, IngestQueueCapacityDesc, nil, c.cfg.Labels),
+		queueFullMetric: prometheus.NewDesc(IngestQueueFullMetric, IngestQueueFullDesc, nil, c.cfg.Labels),
+	}
+	q.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer q.wg.Done()
+			for job := range q.jobs {
+				c.processJob(job)
+				q.latency.Observe(time.Since(job.queuedAt).Seconds())
+			}
+		}()
+	}
+	return q
+}
+
+// enqueue queues job without blocking. It returns errQueueFull if the queue
+// is full and errQueueClosed once the queue was closed.
+func (q *ingestQueue) enqueue(job *ingestJob) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return errQueueClosed
+	}
+	job.queuedAt = time.Now()
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		q.full.Add(1)
+		return errQueueFull
+	}
+}
+
+// close stops accepting jobs and waits until the queued ones are processed.
+func (q *ingestQueue) close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+func (q *ingestQueue) collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(q.lengthMetric, prometheus.GaugeValue, float64(len(q.jobs)))
+	ch <- prometheus.MustNewConstMetric(q.capacityMetric, prometheus.GaugeValue, float64(cap(q.jobs)))
+	ch <- prometheus.MustNewConstMetric(q.queueFullMetric, prometheus.CounterValue, float64(q.full.Load()))
+	ch <- q.latency
+}
+
+// Close stops accepting webhooks and waits until queued webhooks are
+// processed. Webhooks received afterwards are answered with 503.
+func (c *Collector) Close() {
+	c.Drain()
+	if c.queue != nil {
+		c.queue.close()
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+)
+
+func TestIngestQueue(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{IngestWorkers: 2, IngestQueueSize: 10})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	for _, node := range []string{"Bangalore", "Paris", "London"} {
+		w := postWebhook(t, collector, testResponse("1", node, "100"))
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("expected status 202, got %d", w.Code)
+		}
+		if reply := decodeWebhookReply(t, w); reply.Data.Outcome != OutcomeQueued {
+			t.Errorf("expected outcome %q, got %+v", OutcomeQueued, reply)
+		}
+	}
+	// Payloads are still decoded and validated by the handler.
+	if w := postWebhook(t, collector, Response{}); w.Code != http.StatusAccepted {
+		t.Errorf("expected an empty result to be queued, got %d", w.Code)
+	}
+	w := httptest.NewRecorder()
+	collector.HandleWebhook(w, httptest.NewRequest("POST", "/webhook", strings.NewReader("{invalid")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid payload, got %d", w.Code)
+	}
+
+	collector.Close()
+	if nodes := storedNodes(collector); len(nodes) != 4 {
+		t.Errorf("expected queued webhooks to be processed on close, got %v", nodes)
+	}
+	if w := postWebhook(t, collector, testResponse("1", "Paris", "100")); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 after close, got %d", w.Code)
+	}
+
+	expected := `
+# HELP catchpoint_ingest_queue_capacity Maximum number of decoded webhooks waiting for an ingestion worker.
+# TYPE catchpoint_ingest_queue_capacity gauge
+catchpoint_ingest_queue_capacity 10
+# HELP catchpoint_ingest_queue_full_total Number of webhooks rejected with 429 because the ingestion queue was full.
+# TYPE catchpoint_ingest_queue_full_total counter
+catchpoint_ingest_queue_full_total 0
+# HELP catchpoint_ingest_queue_length Number of decoded webhooks waiting for an ingestion worker.
+# TYPE catchpoint_ingest_queue_length gauge
+catchpoint_ingest_queue_length 0
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), IngestQueueCapacityMetric, IngestQueueFullMetric, IngestQueueLengthMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+	if count := testutil.CollectAndCount(collector.queue.latency); count != 1 {
+		t.Errorf("expected the latency histogram to be collected, got %d", count)
+	}
+}
+
+func TestIngestQueueFull(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{})
+	// A queue without workers fills up after its capacity.
+	collector.queue = newIngestQueue(collector, 0, 1)
+	dir := t.TempDir()
+	journal, err := OpenJournal(dir, 0, 0)
+	if err != nil {
+		t.Fatal("failed to open journal:", err)
+	}
+	defer journal.Close()
+	collector.SetJournal(journal)
+
+	if w := postWebhook(t, collector, testResponse("1", "Paris", "100")); w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d", w.Code)
+	}
+	w := postWebhook(t, collector, testResponse("1", "London", "100"))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected status 429 with Retry-After, got %d %v", w.Code, w.Header())
+	}
+	if full := collector.queue.full.Load(); full != 1 {
+		t.Errorf("expected 1 rejected webhook, got %d", full)
+	}
+	if accepted := collector.webhooksAccepted.Load(); accepted != 1 {
+		t.Errorf("expected only the queued webhook to be accepted, got %d", accepted)
+	}
+
+	// The queued webhook is journaled before it is acknowledged, not once a
+	// worker processed it.
+	entries := 0
+	if err := ReadJournal(logger, dir, func(JournalEntry) error { entries++; return nil }); err != nil {
+		t.Fatal("failed to read journal:", err)
+	}
+	if entries != 1 {
+		t.Errorf("expected the queued webhook to be journaled, got %d entries", entries)
+	}
+
+	// Drain the queue by hand, as there are no workers.
+	collector.processJob(<-collector.queue.jobs)
+	if len(storedNodes(collector)) != 1 {
+		t.Errorf("expected the queued webhook to be processed, got %v", storedNodes(collector))
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2, 2)
+	now := time.Now()
+
+	for i, expected := range []bool{true, true, false} {
+		if allowed := limiter.allow("a", now); allowed != expected {
+			t.Errorf("request %d: expected allowed=%v", i, expected)
+		}
+	}
+	// Two tokens per second refill one token in half a second.
+	if !limiter.allow("a", now.Add(500*time.Millisecond)) {
+		t.Error("expected a token after half a second")
+	}
+	if limiter.allow("a", now.Add(500*time.Millisecond)) {
+		t.Error("expected no second token after half a second")
+	}
+
+	// Full buckets are forgotten on the next sweep.
+	limiter.allow("b", now.Add(time.Second))
+	limiter.allow("c", now.Add(2*rateLimiterSweepInterval))
+	if _, ok := limiter.buckets["a"]; ok {
+		t.Error("expected the refilled bucket to be swept")
+	}
+	if len(limiter.buckets) != 1 {
+		t.Errorf("expected only the new bucket to remain, got %d", len(limiter.buckets))
+	}
+}
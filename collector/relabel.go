@@ -0,0 +1,236 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// Relabel actions, with the same semantics as in Prometheus relabel_configs.
+const (
+	RelabelReplace   = "replace"
+	RelabelKeep      = "keep"
+	RelabelDrop      = "drop"
+	RelabelHashMod   = "hashmod"
+	RelabelLabelMap  = "labelmap"
+	RelabelLabelDrop = "labeldrop"
+	RelabelLabelKeep = "labelkeep"
+)
+
+// Label is a single label of a series.
+type Label struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Labels is a label set sorted by name.
+type Labels []Label
+
+func labelsFromMap(m map[string]string) Labels {
+	ls := make(Labels, 0, len(m))
+	for name, value := range m {
+		ls = append(ls, Label{Name: name, Value: value})
+	}
+	sort.Slice(ls, func(i, j int) bool { return ls[i].Name < ls[j].Name })
+	return ls
+}
+
+// Get returns the value of the label with the given name.
+func (ls Labels) Get(name string) string {
+	for _, l := range ls {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+// withLabels returns ls with the given labels added or replaced.
+func (ls Labels) withLabels(extra map[string]string) Labels {
+	m := make(map[string]string, len(ls)+len(extra))
+	for _, l := range ls {
+		m[l.Name] = l.Value
+	}
+	for name, value := range extra {
+		m[name] = value
+	}
+	return labelsFromMap(m)
+}
+
+func (ls Labels) signature() string {
+	var b strings.Builder
+	for _, l := range ls {
+		b.WriteString(l.Name)
+		b.WriteByte(0xff)
+		b.WriteString(l.Value)
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
+
+func (ls Labels) namesAndValues() ([]string, []string) {
+	names := make([]string, len(ls))
+	values := make([]string, len(ls))
+	for i, l := range ls {
+		names[i], values[i] = l.Name, l.Value
+	}
+	return names, values
+}
+
+// RelabelConfig rewrites the labels derived from TestDetails before a result
+// is stored, following Prometheus relabel_config semantics.
+type RelabelConfig struct {
+	SourceLabels []string `yaml:"source_labels"`
+	Separator    *string  `yaml:"separator"`
+	Regex        *Regexp  `yaml:"regex"`
+	Modulus      uint64   `yaml:"modulus"`
+	TargetLabel  string   `yaml:"target_label"`
+	Replacement  *string  `yaml:"replacement"`
+	Action       string   `yaml:"action"`
+}
+
+func (c *RelabelConfig) separator() string {
+	if c.Separator == nil {
+		return ";"
+	}
+	return *c.Separator
+}
+
+func (c *RelabelConfig) regex() Regexp {
+	if c.Regex == nil {
+		return MustNewRegexp("(.*)")
+	}
+	return *c.Regex
+}
+
+func (c *RelabelConfig) replacement() string {
+	if c.Replacement == nil {
+		return "$1"
+	}
+	return *c.Replacement
+}
+
+func (c *RelabelConfig) action() string {
+	if c.Action == "" {
+		return RelabelReplace
+	}
+	return c.Action
+}
+
+func (c *RelabelConfig) validate() error {
+	switch c.action() {
+	case RelabelReplace:
+		if c.TargetLabel == "" {
+			return fmt.Errorf("target_label is required for action %q", RelabelReplace)
+		}
+	case RelabelHashMod:
+		if c.TargetLabel == "" || c.Modulus == 0 {
+			return fmt.Errorf("target_label and modulus are required for action %q", RelabelHashMod)
+		}
+		if !model.LabelName(c.TargetLabel).IsValid() {
+			return fmt.Errorf("invalid target_label %q", c.TargetLabel)
+		}
+	case RelabelKeep, RelabelDrop:
+		if len(c.SourceLabels) == 0 {
+			return fmt.Errorf("source_labels are required for action %q", c.action())
+		}
+	case RelabelLabelMap, RelabelLabelDrop, RelabelLabelKeep:
+	default:
+		return fmt.Errorf("unknown relabel action %q", c.Action)
+	}
+	return nil
+}
+
+// relabel applies cfgs to the labels in place and reports whether the result
+// should be kept. As in Prometheus, labels set to an empty value by a rule are
+// removed and labels starting with "__" are removed once all rules applied.
+func relabel(labels map[string]string, cfgs []RelabelConfig) bool {
+	for i := range cfgs {
+		if !relabelOne(labels, &cfgs[i]) {
+			return false
+		}
+	}
+	for name := range labels {
+		if strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			delete(labels, name)
+		}
+	}
+	return true
+}
+
+func relabelOne(labels map[string]string, cfg *RelabelConfig) bool {
+	values := make([]string, 0, len(cfg.SourceLabels))
+	for _, name := range cfg.SourceLabels {
+		values = append(values, labels[name])
+	}
+	value := strings.Join(values, cfg.separator())
+	regex := cfg.regex()
+
+	switch cfg.action() {
+	case RelabelKeep:
+		return regex.MatchString(value)
+	case RelabelDrop:
+		return !regex.MatchString(value)
+	case RelabelReplace:
+		indexes := regex.FindStringSubmatchIndex(value)
+		if indexes == nil {
+			return true
+		}
+		target := string(regex.ExpandString(nil, cfg.TargetLabel, value, indexes))
+		if !model.LabelName(target).IsValid() {
+			return true
+		}
+		replacement := string(regex.ExpandString(nil, cfg.replacement(), value, indexes))
+		if replacement == "" {
+			delete(labels, target)
+		} else {
+			labels[target] = replacement
+		}
+	case RelabelHashMod:
+		sum := md5.Sum([]byte(value))
+		mod := binary.BigEndian.Uint64(sum[8:]) % cfg.Modulus
+		labels[cfg.TargetLabel] = fmt.Sprint(mod)
+	case RelabelLabelMap:
+		// Map a sorted snapshot of the labels, so mapped labels are not mapped
+		// again and clashing targets resolve the same way every time.
+		for _, l := range labelsFromMap(labels) {
+			if regex.MatchString(l.Name) {
+				target := regex.ReplaceAllString(l.Name, cfg.replacement())
+				if model.LabelName(target).IsValid() {
+					labels[target] = l.Value
+				}
+			}
+		}
+	case RelabelLabelDrop:
+		for name := range labels {
+			if regex.MatchString(name) {
+				delete(labels, name)
+			}
+		}
+	case RelabelLabelKeep:
+		for name := range labels {
+			if !regex.MatchString(name) {
+				delete(labels, name)
+			}
+		}
+	}
+	return true
+}
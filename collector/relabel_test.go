@@ -0,0 +1,175 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+)
+
+func TestRelabelConfigs(t *testing.T) {
+	fileCfg, err := LoadConfigFile(writeConfigFile(t, `
+relabel_configs:
+  - source_labels: [test_name]
+    regex: Internal.*
+    action: drop
+  - source_labels: [node_name]
+    regex: "(.+), (.+) - (.+)"
+    target_label: city
+    replacement: $1
+  - source_labels: [node_name]
+    regex: "(.+), (.+) - (.+)"
+    target_label: isp
+    replacement: $3
+  - source_labels: [node_name]
+    target_label: probe_location
+  - target_label: env
+    replacement: prod
+  - regex: node_id|node_name|client_id|asn|division_id|monitor_type_id|type_id
+    action: labeldrop
+`))
+	if err != nil {
+		t.Fatal("failed to load config file:", err)
+	}
+
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{RelabelConfigs: fileCfg.RelabelConfigs})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	postWebhook(t, collector, testResponse("1", "Bangalore, IN - Tata Teleservices", "100"))
+	postWebhook(t, collector, testResponse("2", "Paris", "200"))
+	internal := testResponse("3", "Paris", "300")
+	internal.TestDetails.TestName = "Internal API"
+	postWebhook(t, collector, internal)
+
+	expected := `
+# HELP catchpoint_total_time Total time it took to load the webpage in milliseconds.
+# TYPE catchpoint_total_time gauge
+catchpoint_total_time{city="Bangalore",env="prod",isp="Tata Teleservices",probe_location="Bangalore, IN - Tata Teleservices",test_id="1",test_name="My Homepage"} 100
+catchpoint_total_time{env="prod",probe_location="Paris",test_id="2",test_name="My Homepage"} 200
+# HELP catchpoint_webhook_filtered_total Number of results dropped by filter rules by rule.
+# TYPE catchpoint_webhook_filtered_total counter
+catchpoint_webhook_filtered_total{rule="relabel"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), TotalTimeMetric, WebhookFilteredMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+}
+
+func TestRelabel(t *testing.T) {
+	for name, tc := range map[string]struct {
+		cfg      RelabelConfig
+		expected map[string]string
+		keep     bool
+	}{
+		"keep match": {
+			cfg:      RelabelConfig{SourceLabels: []string{"test_id"}, Regex: regexpPtr("1|2"), Action: RelabelKeep},
+			expected: map[string]string{"test_id": "1", "node_name": "Paris"},
+			keep:     true,
+		},
+		"keep no match": {
+			cfg:  RelabelConfig{SourceLabels: []string{"test_id"}, Regex: regexpPtr("2"), Action: RelabelKeep},
+			keep: false,
+		},
+		"hashmod": {
+			cfg:      RelabelConfig{SourceLabels: []string{"test_id"}, Modulus: 1, TargetLabel: "shard", Action: RelabelHashMod},
+			expected: map[string]string{"test_id": "1", "node_name": "Paris", "shard": "0"},
+			keep:     true,
+		},
+		"labelmap": {
+			cfg:      RelabelConfig{Regex: regexpPtr("node_(.+)"), Replacement: stringPtr("probe_$1"), Action: RelabelLabelMap},
+			expected: map[string]string{"test_id": "1", "node_name": "Paris", "probe_name": "Paris"},
+			keep:     true,
+		},
+		"labelmap self match": {
+			cfg:      RelabelConfig{Regex: regexpPtr("(.*)"), Replacement: stringPtr("x_$1"), Action: RelabelLabelMap},
+			expected: map[string]string{"test_id": "1", "node_name": "Paris", "x_test_id": "1", "x_node_name": "Paris"},
+			keep:     true,
+		},
+		"labelkeep": {
+			cfg:      RelabelConfig{Regex: regexpPtr("test_id"), Action: RelabelLabelKeep},
+			expected: map[string]string{"test_id": "1"},
+			keep:     true,
+		},
+		"empty replacement": {
+			cfg:      RelabelConfig{TargetLabel: "node_name", Replacement: stringPtr(""), Action: RelabelReplace},
+			expected: map[string]string{"test_id": "1"},
+			keep:     true,
+		},
+	} {
+		labels := map[string]string{"test_id": "1", "node_name": "Paris"}
+		if keep := relabel(labels, []RelabelConfig{tc.cfg}); keep != tc.keep {
+			t.Errorf("%s: expected keep=%t, got %t", name, tc.keep, keep)
+			continue
+		}
+		if !tc.keep {
+			continue
+		}
+		if len(labels) != len(tc.expected) {
+			t.Errorf("%s: expected %v, got %v", name, tc.expected, labels)
+			continue
+		}
+		for k, v := range tc.expected {
+			if labels[k] != v {
+				t.Errorf("%s: expected %v, got %v", name, tc.expected, labels)
+				break
+			}
+		}
+	}
+}
+
+func TestRelabelLabelMapMapsEachLabelOnce(t *testing.T) {
+	cfg := RelabelConfig{Regex: regexpPtr("(.*)"), Replacement: stringPtr("x_$1"), Action: RelabelLabelMap}
+	// Map iteration order is random, so repeat to catch labels added during
+	// the iteration being mapped again.
+	for i := 0; i < 100; i++ {
+		labels := map[string]string{"test_id": "1", "node_id": "2", "node_name": "Paris"}
+		relabel(labels, []RelabelConfig{cfg})
+		if len(labels) != 6 {
+			t.Fatalf("expected 6 labels, got %v", labels)
+		}
+	}
+}
+
+func TestLoadConfigFileInvalidRelabelConfigs(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown action":    "relabel_configs:\n  - {source_labels: [test_id], action: rename}\n",
+		"missing target":    "relabel_configs:\n  - {source_labels: [test_id], action: replace}\n",
+		"missing modulus":   "relabel_configs:\n  - {source_labels: [test_id], target_label: shard, action: hashmod}\n",
+		"keep without src":  "relabel_configs:\n  - {regex: x, action: keep}\n",
+		"invalid regex":     "relabel_configs:\n  - {source_labels: [test_id], regex: '(', action: keep}\n",
+		"invalid in tenant": "tenants:\n  - {name: a, webhook_path: /a, relabel_configs: [{action: drop}]}\n",
+	} {
+		if _, err := LoadConfigFile(writeConfigFile(t, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func regexpPtr(s string) *Regexp {
+	re := MustNewRegexp(s)
+	return &re
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+const (
+	// ReplicatedByHeader marks a webhook forwarded by a peer and carries the
+	// ID of the instance that originally received it. Replicated webhooks are
+	// never forwarded again, which prevents loops between peers.
+	ReplicatedByHeader = "X-Catchpoint-Replicated-By"
+	// ReceivedAtHeader carries the time the original instance received a
+	// replicated webhook, so all replicas agree on it.
+	ReceivedAtHeader = "X-Catchpoint-Received-At"
+	// ReplicationSecretHeader carries the secret shared by the peers. The
+	// other replication headers are ignored on webhooks without it.
+	ReplicationSecretHeader = "X-Catchpoint-Replication-Secret"
+
+	replicationQueueSize  = 1024
+	replicationTimeout    = 10 * time.Second
+	replicationRetries    = 5
+	replicationBackoff    = 500 * time.Millisecond
+	replicationMaxBackoff = 30 * time.Second
+)
+
+type replicationJob struct {
+	body       []byte
+	receivedAt time.Time
+}
+
+// Replicator forwards accepted webhooks to peer exporters over HTTP. Every
+// peer has its own bounded queue, so a slow or unavailable peer neither blocks
+// the webhook handler nor delays the other peers; when a queue is full the
+// webhook is not forwarded to that peer. Failed forwards are retried with
+// backoff, as a peer may be restarting or shedding load for a while.
+type Replicator struct {
+	logger     log.Logger
+	instanceID string
+	peerSecret string
+	secret     string
+	client     *http.Client
+	backoff    time.Duration
+	peers      map[string]chan replicationJob
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewReplicator starts forwarding to the given peer webhook URLs. peerSecret
+// authenticates the replication headers and a non-empty secret is sent to the
+// peers as a bearer token.
+func NewReplicator(logger log.Logger, instanceID string, peers []string, peerSecret, secret string) *Replicator {
+	r := &Replicator{
+		logger:     logger,
+		instanceID: instanceID,
+		peerSecret: peerSecret,
+		secret:     secret,
+		client:     &http.Client{Timeout: replicationTimeout},
+		backoff:    replicationBackoff,
+		peers:      make(map[string]chan replicationJob, len(peers)),
+		done:       make(chan struct{}),
+	}
+	for _, peer := range peers {
+		queue := make(chan replicationJob, replicationQueueSize)
+		r.peers[peer] = queue
+		r.wg.Add(1)
+		go r.run(peer, queue)
+	}
+	return r
+}
+
+// Replicate queues body for forwarding to all peers.
+func (r *Replicator) Replicate(body []byte, receivedAt time.Time) {
+	job := replicationJob{body: body, receivedAt: receivedAt}
+	for peer, queue := range r.peers {
+		select {
+		case queue <- job:
+		default:
+			r.logger.Log("level", "warn", "msg", "Replication queue full, dropping webhook", "peer", peer)
+		}
+	}
+}
+
+// Close stops accepting webhooks and waits until all queued ones are
+// forwarded. Failed forwards are no longer retried.
+func (r *Replicator) Close() {
+	close(r.done)
+	for _, queue := range r.peers {
+		close(queue)
+	}
+	r.wg.Wait()
+}
+
+func (r *Replicator) run(peer string, queue <-chan replicationJob) {
+	defer r.wg.Done()
+	for job := range queue {
+		if err := r.forward(peer, job); err != nil {
+			r.logger.Log("level", "error", "msg", "Failed to replicate webhook", "peer", peer, "error", err)
+		}
+	}
+}
+
+// forward posts job to peer. Network errors and 429 and 5xx responses are
+// retried up to replicationRetries times with exponential backoff, or after
+// the delay of the Retry-After header of the response.
+func (r *Replicator) forward(peer string, job replicationJob) error {
+	backoff := r.backoff
+	for attempt := 0; ; attempt++ {
+		retry, retryAfter, err := r.send(peer, job)
+		if err == nil || !retry || attempt == replicationRetries {
+			return err
+		}
+		delay := backoff
+		if retryAfter > 0 {
+			delay = retryAfter
+		}
+		if delay > replicationMaxBackoff {
+			delay = replicationMaxBackoff
+		}
+		r.logger.Log("level", "debug", "msg", "Retrying replication", "peer", peer, "delay", delay, "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-r.done:
+			timer.Stop()
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// send posts job to peer once and reports whether a failure can be retried
+// and the delay requested by the peer, if any.
+func (r *Replicator) send(peer string, job replicationJob) (bool, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodPost, peer, bytes.NewReader(job.body))
+	if err != nil {
+		return false, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ReplicatedByHeader, r.instanceID)
+	req.Header.Set(ReplicationSecretHeader, r.peerSecret)
+	req.Header.Set(ReceivedAtHeader, job.receivedAt.Format(time.RFC3339Nano))
+	if r.secret != "" {
+		req.Header.Set("Authorization", "Bearer "+r.secret)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return true, 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+		return retry, parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()), fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return false, 0, nil
+}
+
+// parseRetryAfter returns the delay of a Retry-After header value in seconds
+// or as an HTTP date, or 0 if there is none.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// replicatedAt reports whether r was forwarded by a peer and returns the time
+// the original instance received it. Replication headers are only honored
+// with the peer secret, as they would otherwise let any sender pick the
+// receive time and keep webhooks from being forwarded. Receive times after now
+// are clamped to now.
+func replicatedAt(r *http.Request, peerSecret string, now time.Time) (time.Time, bool) {
+	if peerSecret == "" || r.Header.Get(ReplicatedByHeader) == "" {
+		return now, false
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(ReplicationSecretHeader)), []byte(peerSecret)) != 1 {
+		return now, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, r.Header.Get(ReceivedAtHeader))
+	if err != nil || t.After(now) {
+		return now, true
+	}
+	return t, true
+}
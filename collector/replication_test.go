@@ -0,0 +1,204 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/promlog"
+)
+
+func TestReplicationBetweenInstances(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+
+	const instances = 3
+	collectors := make([]*Collector, instances)
+	servers := make([]*httptest.Server, instances)
+	for i := range collectors {
+		collectors[i] = NewCollector(logger, &Config{ReplicationSecret: "peer-secret"})
+		servers[i] = httptest.NewServer(http.HandlerFunc(collectors[i].HandleWebhook))
+		defer servers[i].Close()
+	}
+	for i, c := range collectors {
+		var peers []string
+		for j, server := range servers {
+			if i != j {
+				peers = append(peers, server.URL)
+			}
+		}
+		replicator := NewReplicator(logger, fmt.Sprintf("instance-%d", i), peers, "peer-secret", "")
+		defer replicator.Close()
+		c.SetReplicator(replicator)
+	}
+
+	// Half of the results arrive at each of the first two instances, as
+	// behind a load balancer.
+	postWebhook(t, collectors[0], testResponse("1", "Bangalore", "100"))
+	postWebhook(t, collectors[1], testResponse("2", "Paris", "200"))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		done := true
+		for _, c := range collectors {
+			if len(c.store.list(time.Now())) != 2 {
+				done = false
+			}
+		}
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for results to replicate")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Give any looping webhook a chance to arrive before checking counts.
+	time.Sleep(100 * time.Millisecond)
+	for i, c := range collectors {
+		if got := c.webhooksAccepted.Load(); got != 2 {
+			t.Errorf("instance %d: expected 2 accepted webhooks, got %d", i, got)
+		}
+	}
+
+	a := collectors[0].store.list(time.Now())
+	b := collectors[2].store.list(time.Now())
+	if !a[1].UpdatedAt.Equal(b[1].UpdatedAt) {
+		t.Errorf("expected replicas to share the original receive time, got %v and %v", a[1].UpdatedAt, b[1].UpdatedAt)
+	}
+}
+
+func TestReplicationHeadersRequirePeerSecret(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	backdated := time.Now().Add(-time.Hour).Format(time.RFC3339Nano)
+
+	for name, cfg := range map[string]*Config{
+		"replication disabled": {},
+		"wrong peer secret":    {ReplicationSecret: "peer-secret"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewCollector(logger, cfg)
+			body, _ := json.Marshal(testResponse("1", "Bangalore", "100"))
+			req := httptest.NewRequest("POST", "http://example.com/webhook", bytes.NewReader(body))
+			req.Header.Set(ReplicatedByHeader, "spoofed")
+			req.Header.Set(ReceivedAtHeader, backdated)
+			req.Header.Set(ReplicationSecretHeader, "guess")
+			before := time.Now()
+			c.HandleWebhook(httptest.NewRecorder(), req)
+
+			series := c.store.list(time.Now())
+			if len(series) != 1 {
+				t.Fatalf("expected 1 series, got %d", len(series))
+			}
+			if series[0].UpdatedAt.Before(before) {
+				t.Errorf("expected the spoofed receive time to be ignored, got %v", series[0].UpdatedAt)
+			}
+		})
+	}
+}
+
+func TestReplicatedReceiveTimeClamped(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	c := NewCollector(logger, &Config{ReplicationSecret: "peer-secret"})
+
+	body, _ := json.Marshal(testResponse("1", "Bangalore", "100"))
+	req := httptest.NewRequest("POST", "http://example.com/webhook", bytes.NewReader(body))
+	req.Header.Set(ReplicatedByHeader, "instance-1")
+	req.Header.Set(ReceivedAtHeader, time.Now().Add(time.Hour).Format(time.RFC3339Nano))
+	req.Header.Set(ReplicationSecretHeader, "peer-secret")
+	c.HandleWebhook(httptest.NewRecorder(), req)
+
+	series := c.store.list(time.Now())
+	if len(series) != 1 || series[0].UpdatedAt.After(time.Now()) {
+		t.Errorf("expected a future receive time to be clamped to now, got %+v", series)
+	}
+}
+
+func TestReplicationRetries(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	target := NewCollector(logger, &Config{ReplicationSecret: "peer-secret"})
+
+	// The peer is draining, then rate limiting, before it accepts the webhook.
+	var requests atomic.Int32
+	statuses := []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := int(requests.Add(1)); n <= len(statuses) {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		target.HandleWebhook(w, r)
+	}))
+	defer server.Close()
+
+	replicator := NewReplicator(logger, "instance-0", []string{server.URL}, "peer-secret", "")
+	replicator.backoff = time.Millisecond
+	defer replicator.Close()
+	body, _ := json.Marshal(testResponse("1", "Bangalore", "100"))
+	replicator.Replicate(body, time.Now())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(target.store.list(time.Now())) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the webhook to be replicated after %d requests", requests.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("expected 3 requests, got %d", got)
+	}
+}
+
+func TestReplicationNoRetryOnClientError(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	replicator := NewReplicator(logger, "instance-0", []string{server.URL}, "peer-secret", "")
+	replicator.backoff = time.Millisecond
+	replicator.Replicate([]byte("{}"), time.Now())
+	replicator.Close()
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("expected a rejected webhook not to be retried, got %d requests", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 2, 21, 20, 0, 0, time.UTC)
+	for value, expected := range map[string]time.Duration{
+		"":                              0,
+		"0":                             0,
+		"5":                             5 * time.Second,
+		"soon":                          0,
+		"Thu, 02 May 2024 21:20:30 GMT": 30 * time.Second,
+		"Thu, 02 May 2024 21:19:00 GMT": 0,
+	} {
+		if got := parseRetryAfter(value, now); got != expected {
+			t.Errorf("%q: expected %v, got %v", value, expected, got)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// SourceConfig restricts the source IPs webhooks are accepted from. Entries are
+// CIDR ranges or single IP addresses.
+type SourceConfig struct {
+	// AllowedRanges are the source IPs webhooks are accepted from. All
+	// sources are allowed when empty.
+	AllowedRanges []string `yaml:"allowed_ranges"`
+	// TrustedProxies are the proxies whose X-Forwarded-For and Forwarded
+	// headers name the source IP.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// SourcePolicy is the parsed form of a SourceConfig.
+type SourcePolicy struct {
+	allowed []netip.Prefix
+	trusted []netip.Prefix
+}
+
+// NewSourcePolicy parses cfg.
+func NewSourcePolicy(cfg SourceConfig) (*SourcePolicy, error) {
+	allowed, err := parsePrefixes(cfg.AllowedRanges)
+	if err != nil {
+		return nil, fmt.Errorf("allowed_ranges: %w", err)
+	}
+	trusted, err := parsePrefixes(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("trusted_proxies: %w", err)
+	}
+	return &SourcePolicy{allowed: allowed, trusted: trusted}, nil
+}
+
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// restricted reports whether the policy restricts sources at all.
+func (p *SourcePolicy) restricted() bool {
+	return p != nil && len(p.allowed) > 0
+}
+
+// allows reports whether webhooks are accepted from addr.
+func (p *SourcePolicy) allows(addr netip.Addr) bool {
+	if !p.restricted() {
+		return true
+	}
+	return addr.IsValid() && containsAddr(p.allowed, addr)
+}
+
+// clientIP returns the source IP of r. Requests from trusted proxies are
+// attributed to the rightmost address in their forwarding header that is not
+// a trusted proxy itself, as every address to its left can be spoofed by the
+// client. The result is invalid if that address cannot be parsed.
+func (p *SourcePolicy) clientIP(r *http.Request) netip.Addr {
+	addr := parseHostAddr(r.RemoteAddr)
+	if p == nil || len(p.trusted) == 0 || !containsAddr(p.trusted, addr) {
+		return addr
+	}
+
+	hops := forwardedFor(r.Header.Values("Forwarded"))
+	if hops == nil {
+		for _, value := range r.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(value, ",")...)
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr = parseHostAddr(strings.TrimSpace(hops[i]))
+		if !addr.IsValid() || !containsAddr(p.trusted, addr) {
+			return addr
+		}
+	}
+	return addr
+}
+
+// forwardedFor returns the for parameters of RFC 7239 Forwarded header values.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					hops = append(hops, strings.Trim(value, `"`))
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// parseHostAddr parses an IP address with an optional port. IPv6 addresses
+// with a port are enclosed in brackets. It returns the zero Addr on failure.
+func parseHostAddr(hostport string) netip.Addr {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	addr, err := netip.ParseAddr(strings.Trim(host, "[]"))
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
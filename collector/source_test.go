@@ -0,0 +1,125 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+)
+
+func TestSourcePolicyClientIP(t *testing.T) {
+	policy, err := NewSourcePolicy(SourceConfig{
+		AllowedRanges:  []string{"192.0.2.0/24", "2001:db8::1"},
+		TrustedProxies: []string{"10.0.0.0/8"},
+	})
+	if err != nil {
+		t.Fatal("failed to parse source config:", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		value      string
+		expected   string
+		allowed    bool
+	}{
+		{"direct", "192.0.2.1:1234", "", "", "192.0.2.1", true},
+		{"direct ipv6", "[2001:db8::1]:1234", "", "", "2001:db8::1", true},
+		{"untrusted proxy", "198.51.100.1:1234", "X-Forwarded-For", "192.0.2.1", "198.51.100.1", false},
+		{"trusted proxy", "10.0.0.1:1234", "X-Forwarded-For", "192.0.2.1", "192.0.2.1", true},
+		{"proxy chain", "10.0.0.1:1234", "X-Forwarded-For", "192.0.2.1, 10.0.0.2", "192.0.2.1", true},
+		{"spoofed", "10.0.0.1:1234", "X-Forwarded-For", "192.0.2.1, 198.51.100.1", "198.51.100.1", false},
+		{"forwarded", "10.0.0.1:1234", "Forwarded", `for=192.0.2.1;proto=https, for="[2001:db8::1]:4711"`, "2001:db8::1", true},
+		{"obfuscated", "10.0.0.1:1234", "Forwarded", "for=_hidden", "invalid IP", false},
+		{"no header", "10.0.0.1:1234", "", "", "10.0.0.1", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/webhook", nil)
+			req.RemoteAddr = test.remoteAddr
+			if test.header != "" {
+				req.Header.Set(test.header, test.value)
+			}
+			addr := policy.clientIP(req)
+			if addr.String() != test.expected {
+				t.Errorf("expected client IP %s, got %s", test.expected, addr)
+			}
+			if allowed := policy.allows(addr); allowed != test.allowed {
+				t.Errorf("expected allowed=%v for %s", test.allowed, addr)
+			}
+		})
+	}
+
+	if _, err := NewSourcePolicy(SourceConfig{AllowedRanges: []string{"192.0.2.0/33"}}); err == nil {
+		t.Error("expected an invalid range to be rejected")
+	}
+}
+
+func TestWebhookSources(t *testing.T) {
+	policy, err := NewSourcePolicy(SourceConfig{AllowedRanges: []string{"192.0.2.0/24"}})
+	if err != nil {
+		t.Fatal("failed to parse source config:", err)
+	}
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{Sources: policy})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	send := func(remoteAddr string) int {
+		body, _ := json.Marshal(testResponse("1", "Paris", "100"))
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		collector.HandleWebhook(w, req)
+		return w.Code
+	}
+
+	if code := send("192.0.2.1:1234"); code != http.StatusOK {
+		t.Errorf("expected an allowed source to be accepted, got %d", code)
+	}
+	if code := send("198.51.100.1:1234"); code != http.StatusForbidden {
+		t.Errorf("expected status 403 for a disallowed source, got %d", code)
+	}
+
+	expected := `
+# HELP catchpoint_webhook_source_rejected_total Number of webhooks rejected with 403 because their source IP is not allowed.
+# TYPE catchpoint_webhook_source_rejected_total counter
+catchpoint_webhook_source_rejected_total 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), WebhookSourceRejectedMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+
+	// Reloading replaces the policy of the running collector.
+	policy, _ = NewSourcePolicy(SourceConfig{AllowedRanges: []string{"198.51.100.0/24"}})
+	collector.SetSources(policy)
+	if code := send("198.51.100.1:1234"); code != http.StatusOK {
+		t.Errorf("expected the reloaded range to be accepted, got %d", code)
+	}
+	if code := send("192.0.2.1:1234"); code != http.StatusForbidden {
+		t.Errorf("expected the removed range to be rejected, got %d", code)
+	}
+}
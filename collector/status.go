@@ -0,0 +1,81 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"embed"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+//go:embed templates/status.html
+var templateFS embed.FS
+
+var statusTemplate = template.Must(template.ParseFS(templateFS, "templates/status.html"))
+
+// statusPage is the data rendered by the status template.
+type statusPage struct {
+	Version    string
+	Config     *Config
+	Accepted   uint64
+	Rejected   uint64
+	Series     []statusSeries
+	Rejections []Rejection
+}
+
+// statusSeries is the latest result of a single test and node.
+type statusSeries struct {
+	TestDetails TestDetails
+	Summary     Summary
+	ReceivedAt  time.Time
+	Age         time.Duration
+	Stale       bool
+}
+
+// StatusHandler returns a handler serving the status page at "/". Any other
+// path not handled elsewhere results in a 404.
+func (c *Collector) StatusHandler(version string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		now := time.Now()
+		page := statusPage{
+			Version:    version,
+			Config:     c.cfg,
+			Accepted:   c.webhooksAccepted.Load(),
+			Rejected:   c.webhooksRejected.Load(),
+			Rejections: c.history.recentRejections(),
+		}
+		for _, series := range c.store.list(now) {
+			age := now.Sub(series.UpdatedAt)
+			page.Series = append(page.Series, statusSeries{
+				TestDetails: series.Response.TestDetails,
+				Summary:     series.Response.Summary,
+				ReceivedAt:  series.UpdatedAt,
+				Age:         age.Round(time.Second),
+				Stale:       c.cfg.StaleAfter > 0 && age > c.cfg.StaleAfter,
+			})
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := statusTemplate.Execute(w, page); err != nil {
+			c.logger.Log("level", "error", "msg", "Failed to render status page", "error", err)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/promlog"
+)
+
+func TestStatusPage(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{HistorySize: 1, StaleAfter: time.Nanosecond})
+
+	postWebhook(t, collector, testResponse("123456", "Bangalore, IN - Tata Teleservices", "6591"))
+	req := httptest.NewRequest("POST", "http://example.com/webhook", strings.NewReader(`{"TestDetails": [}`))
+	collector.HandleWebhook(httptest.NewRecorder(), req)
+
+	w := httptest.NewRecorder()
+	collector.StatusHandler("1.2.3").ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		"Version 1.2.3",
+		"Bangalore, IN - Tata Teleservices",
+		"6591",
+		`class="stale"`,
+		"invalid character",
+		"{&#34;TestDetails&#34;: [}",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected status page to contain %q", want)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	collector.StatusHandler("1.2.3").ServeHTTP(w, httptest.NewRequest("GET", "/unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown path, got %d", w.Code)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	StepInfoMetric             = "catchpoint_step_info"
+	StepTotalTimeMetric        = "catchpoint_step_total_time"
+	StepConnectTimeMetric      = "catchpoint_step_connect_time"
+	StepDNSTimeMetric          = "catchpoint_step_dns_time"
+	StepSSLTimeMetric          = "catchpoint_step_ssl_time"
+	StepWaitTimeMetric         = "catchpoint_step_wait_time"
+	StepLoadTimeMetric         = "catchpoint_step_load_time"
+	StepContentLoadTimeMetric  = "catchpoint_step_content_load_time"
+	StepDocumentCompleteMetric = "catchpoint_step_document_complete_time"
+	StepRenderStartTimeMetric  = "catchpoint_step_render_start_time"
+	StepAnyErrorMetric         = "catchpoint_step_any_error"
+	StepConnectionErrorMetric  = "catchpoint_step_connection_error"
+	StepDNSErrorMetric         = "catchpoint_step_dns_error"
+	StepLoadErrorMetric        = "catchpoint_step_load_error"
+	StepTimeoutErrorMetric     = "catchpoint_step_timeout_error"
+	StepTransactionErrorMetric = "catchpoint_step_transaction_error"
+
+	StepInfoDesc             = "Name and URL of a step of a transaction test, with value 1."
+	StepTotalTimeDesc        = "Total time of a step of a transaction test in milliseconds."
+	StepConnectTimeDesc      = "Time taken to connect to the URL of a step in milliseconds."
+	StepDNSTimeDesc          = "Time taken to resolve the domain name of a step in milliseconds."
+	StepSSLTimeDesc          = "Time taken to establish the SSL handshake of a step in milliseconds."
+	StepWaitTimeDesc         = "Time from successful connection to receiving the first byte of a step in milliseconds."
+	StepLoadTimeDesc         = "Time taken to load the first and last byte of the primary URL of a step in milliseconds."
+	StepContentLoadTimeDesc  = "Time taken to load the content of a step in milliseconds."
+	StepDocumentCompleteDesc = "Time taken for the browser to fully render the page of a step in milliseconds."
+	StepRenderStartTimeDesc  = "Time taken to start rendering the page of a step in milliseconds."
+	StepAnyErrorDesc         = "Indicates if any error occurred during a step."
+	StepConnectionErrorDesc  = "Indicates if a connection error occurred during a step."
+	StepDNSErrorDesc         = "Indicates if a DNS error occurred during a step."
+	StepLoadErrorDesc        = "Indicates if a load error occurred during a step."
+	StepTimeoutErrorDesc     = "Indicates if a timeout error occurred during a step."
+	StepTransactionErrorDesc = "Indicates if a transaction error occurred during a step."
+
+	stepLabel     = "step"
+	stepNameLabel = "step_name"
+	stepURLLabel  = "step_url"
+)
+
+// stepMetrics are the per-step gauges of transaction tests. They carry the
+// labels of the series plus the step number.
+type stepMetrics struct {
+	info             *seriesMetric
+	totalTime        *seriesMetric
+	connectTime      *seriesMetric
+	dnsTime          *seriesMetric
+	sslTime          *seriesMetric
+	waitTime         *seriesMetric
+	loadTime         *seriesMetric
+	contentLoadTime  *seriesMetric
+	documentComplete *seriesMetric
+	renderStartTime  *seriesMetric
+	anyError         *seriesMetric
+	connectionError  *seriesMetric
+	dnsError         *seriesMetric
+	loadError        *seriesMetric
+	timeoutError     *seriesMetric
+	transactionError *seriesMetric
+}
+
+func newStepMetrics(constLabels prometheus.Labels) *stepMetrics {
+	return &stepMetrics{
+		info:             newSeriesMetric(StepInfoMetric, StepInfoDesc, constLabels),
+		totalTime:        newSeriesMetric(StepTotalTimeMetric, StepTotalTimeDesc, constLabels),
+		connectTime:      newSeriesMetric(StepConnectTimeMetric, StepConnectTimeDesc, constLabels),
+		dnsTime:          newSeriesMetric(StepDNSTimeMetric, StepDNSTimeDesc, constLabels),
+		sslTime:          newSeriesMetric(StepSSLTimeMetric, StepSSLTimeDesc, constLabels),
+		waitTime:         newSeriesMetric(StepWaitTimeMetric, StepWaitTimeDesc, constLabels),
+		loadTime:         newSeriesMetric(StepLoadTimeMetric, StepLoadTimeDesc, constLabels),
+		contentLoadTime:  newSeriesMetric(StepContentLoadTimeMetric, StepContentLoadTimeDesc, constLabels),
+		documentComplete: newSeriesMetric(StepDocumentCompleteMetric, StepDocumentCompleteDesc, constLabels),
+		renderStartTime:  newSeriesMetric(StepRenderStartTimeMetric, StepRenderStartTimeDesc, constLabels),
+		anyError:         newSeriesMetric(StepAnyErrorMetric, StepAnyErrorDesc, constLabels),
+		connectionError:  newSeriesMetric(StepConnectionErrorMetric, StepConnectionErrorDesc, constLabels),
+		dnsError:         newSeriesMetric(StepDNSErrorMetric, StepDNSErrorDesc, constLabels),
+		loadError:        newSeriesMetric(StepLoadErrorMetric, StepLoadErrorDesc, constLabels),
+		timeoutError:     newSeriesMetric(StepTimeoutErrorMetric, StepTimeoutErrorDesc, constLabels),
+		transactionError: newSeriesMetric(StepTransactionErrorMetric, StepTransactionErrorDesc, constLabels),
+	}
+}
+
+// stepNumber returns the step label value of the step at index i: its step
+// number, or its position if it has none.
+func stepNumber(step *Step, i int) string {
+	if step.Step != "" {
+		return step.Step
+	}
+	return strconv.Itoa(i + 1)
+}
+
+// truncateLabelValue cuts value at limit bytes, dropping a partial trailing
+// rune. A non-positive limit keeps value as is.
+func truncateLabelValue(value string, limit int) string {
+	if limit <= 0 || len(value) <= limit {
+		return value
+	}
+	return strings.ToValidUTF8(value[:limit], "")
+}
+
+// collectSteps emits the step metrics of the result of series, up to the steps
+// limit. Labels are truncated to the label value length limit. Steps with a
+// step number that was already seen are skipped, as their series would clash.
+func (c *Collector) collectSteps(ch chan<- prometheus.Metric, series *Series) {
+	steps := series.Response.Steps
+	if limit := c.cfg.StepsLimit; limit > 0 && len(steps) > limit {
+		steps = steps[:limit]
+	}
+	maxLength := c.cfg.LabelValueLengthLimit
+	seen := make(map[string]bool, len(steps))
+	for i := range steps {
+		step := &steps[i]
+		number := truncateLabelValue(stepNumber(step, i), maxLength)
+		if seen[number] {
+			if c.cfg.VerboseLogging {
+				c.logger.Log("level", "warn", "msg", "Skipping step with duplicate step number", "testID", series.Response.TestDetails.TestId, "step", number)
+			}
+			continue
+		}
+		seen[number] = true
+
+		labels := series.Labels.withLabels(map[string]string{stepLabel: number})
+		c.emitValue(ch, c.steps.info, 1, labels.withLabels(map[string]string{
+			stepNameLabel: truncateLabelValue(step.Name, maxLength),
+			stepURLLabel:  truncateLabelValue(step.URL, maxLength),
+		}))
+
+		c.emitMetric(ch, c.steps.totalTime, step.TotalTime, labels)
+		c.emitMetric(ch, c.steps.connectTime, step.Connect, labels)
+		c.emitMetric(ch, c.steps.dnsTime, step.Dns, labels)
+		c.emitMetric(ch, c.steps.sslTime, step.SSL, labels)
+		c.emitMetric(ch, c.steps.waitTime, step.Wait, labels)
+		c.emitMetric(ch, c.steps.loadTime, step.Load, labels)
+		c.emitMetric(ch, c.steps.contentLoadTime, step.ContentLoad, labels)
+		c.emitMetric(ch, c.steps.documentComplete, step.DocumentComplete, labels)
+		c.emitMetric(ch, c.steps.renderStartTime, step.RenderStart, labels)
+		c.emitMetric(ch, c.steps.anyError, step.AnyError, labels)
+		c.emitMetric(ch, c.steps.connectionError, step.ConnectionError, labels)
+		c.emitMetric(ch, c.steps.dnsError, step.DNSError, labels)
+		c.emitMetric(ch, c.steps.loadError, step.LoadError, labels)
+		c.emitMetric(ch, c.steps.timeoutError, step.TimeoutError, labels)
+		c.emitMetric(ch, c.steps.transactionError, step.TransactionError, labels)
+	}
+}
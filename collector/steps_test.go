@@ -0,0 +1,144 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+)
+
+func TestStepMetrics(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{
+		RelabelConfigs: []RelabelConfig{{Action: RelabelLabelKeep, Regex: regexpPtr("test_id|node_name")}},
+	})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	body, err := os.ReadFile(filepath.Join("testdata", "transaction.json"))
+	if err != nil {
+		t.Fatal("failed to read transaction payload:", err)
+	}
+	w := httptest.NewRecorder()
+	collector.HandleWebhook(w, httptest.NewRequest("POST", "/webhook", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	expected := `
+# HELP catchpoint_step_info Name and URL of a step of a transaction test, with value 1.
+# TYPE catchpoint_step_info gauge
+catchpoint_step_info{node_name="Paris, FR - Orange",step="1",step_name="Home",step_url="https://www.example.com/",test_id="654321"} 1
+catchpoint_step_info{node_name="Paris, FR - Orange",step="2",step_name="Login",step_url="https://www.example.com/login",test_id="654321"} 1
+# HELP catchpoint_step_total_time Total time of a step of a transaction test in milliseconds.
+# TYPE catchpoint_step_total_time gauge
+catchpoint_step_total_time{node_name="Paris, FR - Orange",step="1",test_id="654321"} 1200
+catchpoint_step_total_time{node_name="Paris, FR - Orange",step="2",test_id="654321"} 2600
+# HELP catchpoint_step_dns_time Time taken to resolve the domain name of a step in milliseconds.
+# TYPE catchpoint_step_dns_time gauge
+catchpoint_step_dns_time{node_name="Paris, FR - Orange",step="1",test_id="654321"} 24
+# HELP catchpoint_step_transaction_error Indicates if a transaction error occurred during a step.
+# TYPE catchpoint_step_transaction_error gauge
+catchpoint_step_transaction_error{node_name="Paris, FR - Orange",step="2",test_id="654321"} 1
+# HELP catchpoint_total_time Total time it took to load the webpage in milliseconds.
+# TYPE catchpoint_total_time gauge
+catchpoint_total_time{node_name="Paris, FR - Orange",test_id="654321"} 3800
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		StepInfoMetric, StepTotalTimeMetric, StepDNSTimeMetric, StepTransactionErrorMetric, TotalTimeMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+}
+
+func TestStepMetricsWithoutSteps(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{
+		RelabelConfigs: []RelabelConfig{{Action: RelabelLabelKeep, Regex: regexpPtr("test_id")}},
+	})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	postWebhook(t, collector, testResponse("1", "Paris", "100"))
+	resp := testResponse("2", "Paris", "100")
+	// Steps without numbers are numbered by position and repeated numbers
+	// are skipped.
+	resp.Steps = []Step{{TotalTime: "40"}, {TotalTime: "60"}, {Step: "2", TotalTime: "80"}}
+	postWebhook(t, collector, resp)
+
+	expected := `
+# HELP catchpoint_step_total_time Total time of a step of a transaction test in milliseconds.
+# TYPE catchpoint_step_total_time gauge
+catchpoint_step_total_time{step="1",test_id="2"} 40
+catchpoint_step_total_time{step="2",test_id="2"} 60
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), StepTotalTimeMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+	if count := testutil.CollectAndCount(collector, TotalTimeMetric); count != 2 {
+		t.Errorf("expected the test-level metric of both results, got %d", count)
+	}
+}
+
+func TestStepLimits(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{
+		StepsLimit:            2,
+		LabelValueLengthLimit: 8,
+		RelabelConfigs:        []RelabelConfig{{Action: RelabelLabelKeep, Regex: regexpPtr("test_id")}},
+	})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	resp := testResponse("1", "Paris", "100")
+	resp.Steps = []Step{
+		{Name: "Home", URL: "https://www.example.com/", TotalTime: "40"},
+		{Name: "Login", URL: "https://www.example.com/login", TotalTime: "60"},
+		{Name: "Checkout", URL: "https://www.example.com/checkout", TotalTime: "80"},
+	}
+	postWebhook(t, collector, resp)
+
+	expected := `
+# HELP catchpoint_series_limit_hits_total Number of times a cardinality limit was hit by limit.
+# TYPE catchpoint_series_limit_hits_total counter
+catchpoint_series_limit_hits_total{limit="label_value_length"} 0
+catchpoint_series_limit_hits_total{limit="steps_per_result"} 1
+# HELP catchpoint_step_info Name and URL of a step of a transaction test, with value 1.
+# TYPE catchpoint_step_info gauge
+catchpoint_step_info{step="1",step_name="Home",step_url="https://",test_id="1"} 1
+catchpoint_step_info{step="2",step_name="Login",step_url="https://",test_id="1"} 1
+# HELP catchpoint_step_total_time Total time of a step of a transaction test in milliseconds.
+# TYPE catchpoint_step_total_time gauge
+catchpoint_step_total_time{step="1",test_id="1"} 40
+catchpoint_step_total_time{step="2",test_id="1"} 60
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), SeriesLimitHitsMetric, StepInfoMetric, StepTotalTimeMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+}
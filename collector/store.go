@@ -0,0 +1,304 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	errSeriesLimit = errors.New("series limit reached")
+	errDuplicate   = errors.New("duplicate of the stored result")
+	errOutOfOrder  = errors.New("older than the stored result")
+)
+
+// Series limit policies.
+const (
+	LimitPolicyReject = "reject"
+	LimitPolicyEvict  = "evict"
+)
+
+// Limit label values of catchpoint_series_limit_hits_total.
+const (
+	limitSeries           = "series"
+	limitSeriesPerTest    = "series_per_test"
+	limitLabelValueLength = "label_value_length"
+	limitHostsPerResult   = "hosts_per_result"
+	limitStepsPerResult   = "steps_per_result"
+)
+
+// Series is the latest result received for a single label set, which by
+// default is one per test and node.
+type Series struct {
+	Response  Response  `json:"response"`
+	Labels    Labels    `json:"labels,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	hash [sha256.Size]byte
+}
+
+// hashResponse returns the content hash used to detect duplicate results.
+func hashResponse(resp *Response) [sha256.Size]byte {
+	data, _ := json.Marshal(resp)
+	return sha256.Sum256(data)
+}
+
+// supersedes returns nil if resp may replace the stored result of the
+// series, or errDuplicate or errOutOfOrder. Results are ordered by
+// Response.Time; results without a time are never out of order.
+func (series *Series) supersedes(resp *Response, hash [sha256.Size]byte) error {
+	if series.hash == hash {
+		return errDuplicate
+	}
+	t, ok := resp.Time()
+	if !ok {
+		return nil
+	}
+	if stored, ok := series.Response.Time(); ok && t.Before(stored) {
+		return errOutOfOrder
+	}
+	return nil
+}
+
+// seriesLimits bound the number of series in a store. Non-positive limits are
+// disabled. At a limit, new series are rejected or, with evict set, replace
+// the least recently updated series.
+type seriesLimits struct {
+	total   int
+	perTest int
+	evict   bool
+}
+
+// seriesStore holds the latest result per label set. Series that have not
+// been updated within the TTL are dropped; a non-positive TTL keeps them forever.
+// A test and node ID have a single series, so the series of a renamed node is
+// replaced rather than kept next to the new one. onDrop, if set, is called
+// with every series that expires or is evicted.
+type seriesStore struct {
+	mu     sync.RWMutex
+	ttl    time.Duration
+	limits seriesLimits
+	series map[string]*Series
+	nodes  map[seriesKey]string
+	tests  map[string]int
+	onDrop func(*Series)
+}
+
+// seriesKey identifies the series of a test and node ID.
+type seriesKey struct {
+	testID string
+	nodeID string
+}
+
+func newSeriesStore(ttl time.Duration, limits seriesLimits) *seriesStore {
+	return &seriesStore{
+		ttl:    ttl,
+		limits: limits,
+		series: make(map[string]*Series),
+		nodes:  make(map[seriesKey]string),
+		tests:  make(map[string]int),
+	}
+}
+
+func keyOf(resp *Response) (seriesKey, bool) {
+	details := &resp.TestDetails
+	return seriesKey{testID: details.TestId, nodeID: details.NodeId}, details.NodeId != ""
+}
+
+// put stores series under sig, replacing a series of the same test and node
+// with a different label set. It must be called with s.mu held.
+func (s *seriesStore) put(sig string, series *Series) {
+	if key, ok := keyOf(&series.Response); ok {
+		if old, ok := s.nodes[key]; ok && old != sig {
+			s.remove(old)
+		}
+		s.nodes[key] = sig
+	}
+	if old, ok := s.series[sig]; ok {
+		s.countTest(old.Response.TestDetails.TestId, -1)
+	}
+	s.countTest(series.Response.TestDetails.TestId, 1)
+	s.series[sig] = series
+}
+
+// remove deletes the series stored under sig. It must be called with s.mu held.
+func (s *seriesStore) remove(sig string) {
+	series, ok := s.series[sig]
+	if !ok {
+		return
+	}
+	if key, ok := keyOf(&series.Response); ok && s.nodes[key] == sig {
+		delete(s.nodes, key)
+	}
+	s.countTest(series.Response.TestDetails.TestId, -1)
+	delete(s.series, sig)
+}
+
+// drop removes the series stored under sig because it expired or was evicted.
+// It must be called with s.mu held.
+func (s *seriesStore) drop(sig string) {
+	series, ok := s.series[sig]
+	if !ok {
+		return
+	}
+	s.remove(sig)
+	if s.onDrop != nil {
+		s.onDrop(series)
+	}
+}
+
+func (s *seriesStore) countTest(testID string, delta int) {
+	if s.tests[testID] += delta; s.tests[testID] <= 0 {
+		delete(s.tests, testID)
+	}
+}
+
+// admit makes room for a series under sig according to the limits. It
+// returns the limit that was hit, if any, and whether the series may be
+// stored. Updates of existing series and renamed nodes are always admitted.
+// It must be called with s.mu held.
+func (s *seriesStore) admit(sig string, resp *Response, evict bool) (string, bool) {
+	if _, ok := s.series[sig]; ok {
+		return "", true
+	}
+	if key, ok := keyOf(resp); ok {
+		if _, ok := s.nodes[key]; ok {
+			return "", true
+		}
+	}
+
+	testID := resp.TestDetails.TestId
+	if s.limits.perTest > 0 && s.tests[testID] >= s.limits.perTest {
+		if !evict {
+			return limitSeriesPerTest, false
+		}
+		s.evictOldest(func(series *Series) bool { return series.Response.TestDetails.TestId == testID })
+		return limitSeriesPerTest, true
+	}
+	if s.limits.total > 0 && len(s.series) >= s.limits.total {
+		if !evict {
+			return limitSeries, false
+		}
+		s.evictOldest(func(*Series) bool { return true })
+		return limitSeries, true
+	}
+	return "", true
+}
+
+// evictOldest removes the least recently updated series matching fn. It must
+// be called with s.mu held.
+func (s *seriesStore) evictOldest(fn func(*Series) bool) {
+	var (
+		oldest string
+		found  *Series
+	)
+	for sig, series := range s.series {
+		if fn(series) && (found == nil || series.UpdatedAt.Before(found.UpdatedAt)) {
+			oldest, found = sig, series
+		}
+	}
+	if found != nil {
+		s.drop(oldest)
+	}
+}
+
+func (s *seriesStore) expired(series *Series, now time.Time) bool {
+	return s.ttl > 0 && now.Sub(series.UpdatedAt) > s.ttl
+}
+
+// set stores resp as the latest result of the series identified by labels.
+// It returns the limit that was hit, if any, and an error if resp was not
+// stored: errDuplicate or errOutOfOrder if the stored result is identical or
+// newer, or errSeriesLimit if there is no room for a new series.
+func (s *seriesStore) set(resp Response, labels Labels, updatedAt time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sig := labels.signature()
+	hash := hashResponse(&resp)
+	stored, ok := s.series[sig]
+	if key, hasKey := keyOf(&resp); !ok && hasKey {
+		stored, ok = s.series[s.nodes[key]]
+	}
+	if ok {
+		if err := stored.supersedes(&resp, hash); err != nil {
+			return "", err
+		}
+	}
+	limit, ok := s.admit(sig, &resp, s.limits.evict)
+	if !ok {
+		return limit, errSeriesLimit
+	}
+	s.put(sig, &Series{Response: resp, Labels: labels, UpdatedAt: updatedAt, hash: hash})
+	return limit, nil
+}
+
+// restore adds previously persisted series that have not expired yet and
+// returns the ones kept. Series already present are not overwritten and
+// series beyond the limits are skipped.
+func (s *seriesStore) restore(series []Series, now time.Time) []Series {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var restored []Series
+	for i := range series {
+		if s.expired(&series[i], now) {
+			continue
+		}
+		key := series[i].Labels.signature()
+		if _, ok := s.series[key]; ok {
+			continue
+		}
+		if _, ok := s.admit(key, &series[i].Response, false); !ok {
+			continue
+		}
+		series[i].hash = hashResponse(&series[i].Response)
+		s.put(key, &series[i])
+		restored = append(restored, series[i])
+	}
+	return restored
+}
+
+// list drops expired series and returns the remaining ones sorted by test,
+// node and labels.
+func (s *seriesStore) list(now time.Time) []Series {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Series, 0, len(s.series))
+	for sig, series := range s.series {
+		if s.expired(series, now) {
+			s.drop(sig)
+			continue
+		}
+		list = append(list, *series)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := &list[i].Response.TestDetails, &list[j].Response.TestDetails
+		if a.TestId != b.TestId {
+			return a.TestId < b.TestId
+		}
+		if a.NodeName != b.NodeName {
+			return a.NodeName < b.NodeName
+		}
+		return list[i].Labels.signature() < list[j].Labels.signature()
+	})
+	return list
+}
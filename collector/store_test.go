@@ -0,0 +1,139 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+)
+
+func storedNodes(c *Collector) []string {
+	var nodes []string
+	for _, series := range c.store.list(time.Now()) {
+		nodes = append(nodes, series.Response.TestDetails.TestId+"/"+series.Response.TestDetails.NodeName)
+	}
+	return nodes
+}
+
+func TestSeriesLimitReject(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{SeriesLimit: 2, SeriesLimitPolicy: LimitPolicyReject})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	postWebhook(t, collector, testResponse("1", "Bangalore", "100"))
+	postWebhook(t, collector, testResponse("1", "Paris", "200"))
+	postWebhook(t, collector, testResponse("2", "Paris", "300"))
+	// Updates of existing series are not limited.
+	postWebhook(t, collector, testResponse("1", "Paris", "400"))
+
+	if nodes := storedNodes(collector); strings.Join(nodes, ",") != "1/Bangalore,1/Paris" {
+		t.Errorf("expected the new series to be rejected, got %v", nodes)
+	}
+
+	expected := `
+# HELP catchpoint_series_limit_hits_total Number of times a cardinality limit was hit by limit.
+# TYPE catchpoint_series_limit_hits_total counter
+catchpoint_series_limit_hits_total{limit="series"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), SeriesLimitHitsMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+}
+
+func TestSeriesLimitPerTestEvict(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{SeriesLimitPerTest: 2, SeriesLimitPolicy: LimitPolicyEvict})
+
+	for _, node := range []string{"Bangalore", "Paris", "London"} {
+		postWebhook(t, collector, testResponse("1", node, "100"))
+		time.Sleep(time.Millisecond)
+	}
+	postWebhook(t, collector, testResponse("2", "Paris", "100"))
+
+	if nodes := storedNodes(collector); strings.Join(nodes, ",") != "1/London,1/Paris,2/Paris" {
+		t.Errorf("expected the least recently updated series of test 1 to be evicted, got %v", nodes)
+	}
+	if hits := collector.limitHits[limitSeriesPerTest].Load(); hits != 1 {
+		t.Errorf("expected 1 limit hit, got %d", hits)
+	}
+}
+
+func TestLabelValueLengthLimit(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{LabelValueLengthLimit: 8})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	resp := testResponse("1", "São Paulo, BR", "100")
+	resp.TestDetails.NodeId = "1"
+	postWebhook(t, collector, resp)
+
+	expected := `
+# HELP catchpoint_series_limit_hits_total Number of times a cardinality limit was hit by limit.
+# TYPE catchpoint_series_limit_hits_total counter
+catchpoint_series_limit_hits_total{limit="label_value_length"} 2
+# HELP catchpoint_total_time Total time it took to load the webpage in milliseconds.
+# TYPE catchpoint_total_time gauge
+catchpoint_total_time{asn="",client_id="",division_id="",monitor_type_id="",node_id="1",node_name="São Pau",test_id="1",test_name="My Homep",type_id=""} 100
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), TotalTimeMetric, SeriesLimitHitsMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+}
+
+func TestOutOfOrderAndDuplicates(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	newer := testResponse("1", "Paris", "200")
+	newer.Summary.Timestamp = "20240502212044798"
+	older := testResponse("1", "Paris", "100")
+	older.Summary.Timestamp = "20240502211544798"
+
+	postWebhook(t, collector, newer)
+	postWebhook(t, collector, older)
+	postWebhook(t, collector, newer)
+	// Results without a timestamp cannot be ordered and replace the stored one.
+	postWebhook(t, collector, testResponse("1", "Paris", "300"))
+
+	expected := `
+# HELP catchpoint_total_time Total time it took to load the webpage in milliseconds.
+# TYPE catchpoint_total_time gauge
+catchpoint_total_time{asn="",client_id="",division_id="",monitor_type_id="",node_id="Paris",node_name="Paris",test_id="1",test_name="My Homepage",type_id=""} 300
+# HELP catchpoint_webhook_duplicates_total Number of results ignored because they were identical to the stored result.
+# TYPE catchpoint_webhook_duplicates_total counter
+catchpoint_webhook_duplicates_total 1
+# HELP catchpoint_webhook_out_of_order_total Number of results ignored because a newer result of the series was stored.
+# TYPE catchpoint_webhook_out_of_order_total counter
+catchpoint_webhook_out_of_order_total 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), TotalTimeMetric, WebhookDuplicatesMetric, WebhookOutOfOrderMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// StreamPath is the Server-Sent Events endpoint for incoming webhooks.
+	StreamPath = "/api/v1/stream"
+
+	OutcomeAccepted   = "accepted"
+	OutcomeRejected   = "rejected"
+	OutcomeFiltered   = "filtered"
+	OutcomeDuplicate  = "duplicate"
+	OutcomeOutOfOrder = "out_of_order"
+
+	streamBufferSize        = 64
+	streamKeepaliveInterval = 15 * time.Second
+)
+
+// StreamEvent describes a single webhook as seen by HandleWebhook.
+type StreamEvent struct {
+	Time     time.Time `json:"time"`
+	Outcome  string    `json:"outcome"`
+	Error    string    `json:"error,omitempty"`
+	Response *Response `json:"response,omitempty"`
+}
+
+// streamBroker fans out webhook events to connected stream clients. Publishing
+// never blocks: events for clients whose buffer is full are dropped and
+// reported to the client once it catches up.
+type streamBroker struct {
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	events  chan StreamEvent
+	testID  string
+	node    string
+	dropped atomic.Uint64
+}
+
+func newStreamBroker() *streamBroker {
+	return &streamBroker{subscribers: make(map[*subscriber]struct{})}
+}
+
+func (b *streamBroker) subscribe(testID, node string) *subscriber {
+	s := &subscriber{
+		events: make(chan StreamEvent, streamBufferSize),
+		testID: testID,
+		node:   node,
+	}
+	b.mu.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+func (b *streamBroker) unsubscribe(s *subscriber) {
+	b.mu.Lock()
+	delete(b.subscribers, s)
+	b.mu.Unlock()
+}
+
+func (b *streamBroker) publish(event StreamEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		if !s.matches(event) {
+			continue
+		}
+		select {
+		case s.events <- event:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// matches reports whether event passes the subscriber's filters. Events
+// without a decoded response only match unfiltered subscribers.
+func (s *subscriber) matches(event StreamEvent) bool {
+	if s.testID == "" && s.node == "" {
+		return true
+	}
+	if event.Response == nil {
+		return false
+	}
+	details := event.Response.TestDetails
+	if s.testID != "" && details.TestId != s.testID {
+		return false
+	}
+	if s.node != "" && details.NodeName != s.node && details.NodeId != s.node {
+		return false
+	}
+	return true
+}
+
+// HandleStream serves GET /api/v1/stream as Server-Sent Events. The optional
+// test_id and node query parameters restrict the stream to matching results;
+// node matches either the node name or the node ID.
+func (c *Collector) HandleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	query := r.URL.Query()
+	s := c.stream.subscribe(query.Get("test_id"), query.Get("node"))
+	defer c.stream.unsubscribe(s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	// Streams are long-lived and exempt from the server's write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	keepalive := time.NewTicker(streamKeepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case event := <-s.events:
+			if dropped := s.dropped.Swap(0); dropped > 0 {
+				if _, err := fmt.Fprintf(w, "event: dropped\ndata: {\"count\":%d}\n\n", dropped); err != nil {
+					return
+				}
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				c.logger.Log("level", "error", "msg", "Failed to encode stream event", "error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Outcome, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
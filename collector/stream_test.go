@@ -0,0 +1,93 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/promlog"
+)
+
+func TestStreamFiltersEvents(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{})
+	server := httptest.NewServer(http.HandlerFunc(collector.HandleStream))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?test_id=1")
+	if err != nil {
+		t.Fatal("failed to connect to stream:", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %q", ct)
+	}
+
+	// The subscription is registered before the headers are flushed.
+	postWebhook(t, collector, testResponse("2", "Paris", "100"))
+	postWebhook(t, collector, testResponse("1", "Paris", "200"))
+
+	events := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			events <- scanner.Text()
+		}
+		close(events)
+	}()
+
+	var lines []string
+	timeout := time.After(5 * time.Second)
+	for len(lines) < 2 {
+		select {
+		case line := <-events:
+			if line != "" {
+				lines = append(lines, line)
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for stream event")
+		}
+	}
+
+	if lines[0] != "event: "+OutcomeAccepted {
+		t.Errorf("expected accepted event, got %q", lines[0])
+	}
+	var event StreamEvent
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &event); err != nil {
+		t.Fatal("failed to decode event:", err)
+	}
+	if event.Response == nil || event.Response.TestDetails.TestId != "1" {
+		t.Errorf("expected event for test 1, got %+v", event)
+	}
+}
+
+func TestStreamPublishDoesNotBlock(t *testing.T) {
+	broker := newStreamBroker()
+	s := broker.subscribe("", "")
+
+	for i := 0; i < streamBufferSize+10; i++ {
+		broker.publish(StreamEvent{Outcome: OutcomeRejected})
+	}
+
+	if got := s.dropped.Load(); got != 10 {
+		t.Errorf("expected 10 dropped events, got %d", got)
+	}
+}
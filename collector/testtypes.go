@@ -0,0 +1,228 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Test types. The type of a result is selected by its TypeId and decides
+// which type-specific section of the payload is exported. Web tests only have
+// a Summary.
+const (
+	TestTypeWeb        = "web"
+	TestTypePing       = "ping"
+	TestTypeDNS        = "dns"
+	TestTypeTraceroute = "traceroute"
+	TestTypeSSL        = "ssl"
+	TestTypeAPI        = "api"
+)
+
+// DefaultTestTypes maps the Catchpoint TypeId values of the supported test
+// types to their test type. Other TypeId values are web tests. The test_types
+// setting of the config file overrides them, see MergeTestTypes.
+var DefaultTestTypes = map[string]string{
+	"3":  TestTypeTraceroute,
+	"4":  TestTypePing,
+	"7":  TestTypeDNS,
+	"9":  TestTypeAPI,
+	"16": TestTypeSSL,
+}
+
+func validTestType(testType string) bool {
+	switch testType {
+	case TestTypeWeb, TestTypePing, TestTypeDNS, TestTypeTraceroute, TestTypeSSL, TestTypeAPI:
+		return true
+	}
+	return false
+}
+
+const (
+	PingRoundTripTimeMetric            = "catchpoint_ping_round_trip_time"
+	PingMinRoundTripTimeMetric         = "catchpoint_ping_min_round_trip_time"
+	PingMaxRoundTripTimeMetric         = "catchpoint_ping_max_round_trip_time"
+	PingPacketLossMetric               = "catchpoint_ping_packet_loss"
+	PingJitterMetric                   = "catchpoint_ping_jitter"
+	DNSResolutionTimeMetric            = "catchpoint_dns_resolution_time"
+	DNSResponseCodeMetric              = "catchpoint_dns_response_code"
+	DNSRecordsCountMetric              = "catchpoint_dns_records_count"
+	TracerouteHopCountMetric           = "catchpoint_traceroute_hop_count"
+	TracerouteDestinationReachedMetric = "catchpoint_traceroute_destination_reached"
+	TracerouteRoundTripTimeMetric      = "catchpoint_traceroute_round_trip_time"
+	SSLCertificateDaysToExpiryMetric   = "catchpoint_ssl_certificate_days_to_expiry"
+	SSLCertificateExpiryMetric         = "catchpoint_ssl_certificate_expiry_timestamp_seconds"
+	SSLCertificateValidMetric          = "catchpoint_ssl_certificate_valid"
+	APIResponseCodeMetric              = "catchpoint_api_response_code"
+	APIFailedAssertionsCountMetric     = "catchpoint_api_failed_assertions_count"
+
+	PingRoundTripTimeDesc            = "Average round trip time of the ping packets in milliseconds."
+	PingMinRoundTripTimeDesc         = "Minimum round trip time of the ping packets in milliseconds."
+	PingMaxRoundTripTimeDesc         = "Maximum round trip time of the ping packets in milliseconds."
+	PingPacketLossDesc               = "Percentage of ping packets lost."
+	PingJitterDesc                   = "Variation of the round trip time of the ping packets in milliseconds."
+	DNSResolutionTimeDesc            = "Time taken to resolve the queried name in milliseconds."
+	DNSResponseCodeDesc              = "DNS response code (RCODE) of the query, 0 meaning no error."
+	DNSRecordsCountDesc              = "Number of records in the DNS answer."
+	TracerouteHopCountDesc           = "Number of hops to the destination or the last responding hop."
+	TracerouteDestinationReachedDesc = "Indicates if the traceroute reached the destination."
+	TracerouteRoundTripTimeDesc      = "Round trip time to the last hop in milliseconds."
+	SSLCertificateDaysToExpiryDesc   = "Number of days until the SSL certificate expires, negative once it expired."
+	SSLCertificateExpiryDesc         = "Time the SSL certificate expires in seconds since the epoch."
+	SSLCertificateValidDesc          = "Indicates if the SSL certificate is valid."
+	APIResponseCodeDesc              = "HTTP response code of the API test."
+	APIFailedAssertionsCountDesc     = "Number of assertions of the API test that failed."
+)
+
+// dnsResponseCodes are the DNS RCODE names accepted in DNSResult.
+var dnsResponseCodes = map[string]float64{
+	"NOERROR":  0,
+	"FORMERR":  1,
+	"SERVFAIL": 2,
+	"NXDOMAIN": 3,
+	"NOTIMP":   4,
+	"REFUSED":  5,
+}
+
+// testTypeMetrics are the gauges of the type-specific results.
+type testTypeMetrics struct {
+	pingRoundTripTime            *seriesMetric
+	pingMinRoundTripTime         *seriesMetric
+	pingMaxRoundTripTime         *seriesMetric
+	pingPacketLoss               *seriesMetric
+	pingJitter                   *seriesMetric
+	dnsResolutionTime            *seriesMetric
+	dnsResponseCode              *seriesMetric
+	dnsRecordsCount              *seriesMetric
+	tracerouteHopCount           *seriesMetric
+	tracerouteDestinationReached *seriesMetric
+	tracerouteRoundTripTime      *seriesMetric
+	sslDaysToExpiry              *seriesMetric
+	sslExpiry                    *seriesMetric
+	sslValid                     *seriesMetric
+	apiResponseCode              *seriesMetric
+	apiFailedAssertionsCount     *seriesMetric
+}
+
+func newTestTypeMetrics(constLabels prometheus.Labels) *testTypeMetrics {
+	return &testTypeMetrics{
+		pingRoundTripTime:            newSeriesMetric(PingRoundTripTimeMetric, PingRoundTripTimeDesc, constLabels),
+		pingMinRoundTripTime:         newSeriesMetric(PingMinRoundTripTimeMetric, PingMinRoundTripTimeDesc, constLabels),
+		pingMaxRoundTripTime:         newSeriesMetric(PingMaxRoundTripTimeMetric, PingMaxRoundTripTimeDesc, constLabels),
+		pingPacketLoss:               newSeriesMetric(PingPacketLossMetric, PingPacketLossDesc, constLabels),
+		pingJitter:                   newSeriesMetric(PingJitterMetric, PingJitterDesc, constLabels),
+		dnsResolutionTime:            newSeriesMetric(DNSResolutionTimeMetric, DNSResolutionTimeDesc, constLabels),
+		dnsResponseCode:              newSeriesMetric(DNSResponseCodeMetric, DNSResponseCodeDesc, constLabels),
+		dnsRecordsCount:              newSeriesMetric(DNSRecordsCountMetric, DNSRecordsCountDesc, constLabels),
+		tracerouteHopCount:           newSeriesMetric(TracerouteHopCountMetric, TracerouteHopCountDesc, constLabels),
+		tracerouteDestinationReached: newSeriesMetric(TracerouteDestinationReachedMetric, TracerouteDestinationReachedDesc, constLabels),
+		tracerouteRoundTripTime:      newSeriesMetric(TracerouteRoundTripTimeMetric, TracerouteRoundTripTimeDesc, constLabels),
+		sslDaysToExpiry:              newSeriesMetric(SSLCertificateDaysToExpiryMetric, SSLCertificateDaysToExpiryDesc, constLabels),
+		sslExpiry:                    newSeriesMetric(SSLCertificateExpiryMetric, SSLCertificateExpiryDesc, constLabels),
+		sslValid:                     newSeriesMetric(SSLCertificateValidMetric, SSLCertificateValidDesc, constLabels),
+		apiResponseCode:              newSeriesMetric(APIResponseCodeMetric, APIResponseCodeDesc, constLabels),
+		apiFailedAssertionsCount:     newSeriesMetric(APIFailedAssertionsCountMetric, APIFailedAssertionsCountDesc, constLabels),
+	}
+}
+
+// testType returns the test type of a result with the given TypeId.
+func (c *Collector) testType(typeID string) string {
+	testTypes := c.cfg.TestTypes
+	if testTypes == nil {
+		testTypes = DefaultTestTypes
+	}
+	if testType, ok := testTypes[typeID]; ok {
+		return testType
+	}
+	return TestTypeWeb
+}
+
+// collectTestType emits the metrics of the type-specific section of the
+// result of series. Sections of other test types are ignored.
+func (c *Collector) collectTestType(ch chan<- prometheus.Metric, series *Series) {
+	resp := &series.Response
+	labels := series.Labels
+	m := c.testTypes
+
+	switch c.testType(resp.TestDetails.TypeId) {
+	case TestTypePing:
+		if ping := resp.Ping; ping != nil {
+			c.emitMetric(ch, m.pingRoundTripTime, ping.RoundTripTime, labels)
+			c.emitMetric(ch, m.pingMinRoundTripTime, ping.MinRoundTripTime, labels)
+			c.emitMetric(ch, m.pingMaxRoundTripTime, ping.MaxRoundTripTime, labels)
+			c.emitMetric(ch, m.pingPacketLoss, ping.PacketLoss, labels)
+			c.emitMetric(ch, m.pingJitter, ping.Jitter, labels)
+		}
+	case TestTypeDNS:
+		if dns := resp.DNS; dns != nil {
+			c.emitMetric(ch, m.dnsResolutionTime, dns.ResolutionTime, labels)
+			if code, ok := dnsResponseCodes[strings.ToUpper(strings.TrimSpace(dns.ResponseCode))]; ok {
+				c.emitValue(ch, m.dnsResponseCode, code, labels)
+			} else {
+				c.emitMetric(ch, m.dnsResponseCode, dns.ResponseCode, labels)
+			}
+			c.emitMetric(ch, m.dnsRecordsCount, dns.RecordsCount, labels)
+		}
+	case TestTypeTraceroute:
+		if traceroute := resp.Traceroute; traceroute != nil {
+			c.emitMetric(ch, m.tracerouteHopCount, traceroute.HopCount, labels)
+			c.emitMetric(ch, m.tracerouteDestinationReached, traceroute.DestinationReached, labels)
+			c.emitMetric(ch, m.tracerouteRoundTripTime, traceroute.RoundTripTime, labels)
+		}
+	case TestTypeSSL:
+		if ssl := resp.SSL; ssl != nil {
+			// The days to expiry are computed at scrape time, so they keep
+			// decreasing between test runs.
+			if expiry, ok := parseCatchpointTime(ssl.CertificateExpiry); ok {
+				c.emitValue(ch, m.sslDaysToExpiry, time.Until(expiry).Hours()/24, labels)
+				c.emitValue(ch, m.sslExpiry, float64(expiry.Unix()), labels)
+			} else {
+				c.emitMetric(ch, m.sslDaysToExpiry, ssl.DaysToExpiry, labels)
+			}
+			c.emitMetric(ch, m.sslValid, ssl.CertificateValid, labels)
+		}
+	case TestTypeAPI:
+		if api := resp.API; api != nil {
+			c.emitMetric(ch, m.apiResponseCode, api.ResponseCode, labels)
+			c.emitMetric(ch, m.apiFailedAssertionsCount, api.FailedAssertionsCount, labels)
+		}
+	}
+}
+
+// MergeTestTypes returns DefaultTestTypes with the entries of overrides added
+// or replaced.
+func MergeTestTypes(overrides map[string]string) map[string]string {
+	testTypes := make(map[string]string, len(DefaultTestTypes)+len(overrides))
+	for typeID, testType := range DefaultTestTypes {
+		testTypes[typeID] = testType
+	}
+	for typeID, testType := range overrides {
+		testTypes[typeID] = testType
+	}
+	return testTypes
+}
+
+// validateTestTypes checks a TypeId to test type mapping.
+func validateTestTypes(testTypes map[string]string) error {
+	for typeID, testType := range testTypes {
+		if !validTestType(testType) {
+			return fmt.Errorf("TypeId %q: unknown test type %q", typeID, testType)
+		}
+	}
+	return nil
+}
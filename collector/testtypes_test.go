@@ -0,0 +1,211 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+)
+
+// newTestTypeCollector returns a collector that only keeps the test_id label.
+func newTestTypeCollector(t *testing.T, testTypes map[string]string) (*Collector, *prometheus.Registry) {
+	t.Helper()
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{
+		TestTypes:      testTypes,
+		RelabelConfigs: []RelabelConfig{{Action: RelabelLabelKeep, Regex: regexpPtr("test_id")}},
+	})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+	return collector, registry
+}
+
+func postTestdata(t *testing.T, c *Collector, file string) {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal("failed to read payload:", err)
+	}
+	w := httptest.NewRecorder()
+	c.HandleWebhook(w, httptest.NewRequest("POST", "/webhook", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for %s, got %d: %s", file, w.Code, w.Body)
+	}
+}
+
+func TestTestTypeMetrics(t *testing.T) {
+	for _, tc := range []struct {
+		file     string
+		expected string
+		metrics  []string
+	}{
+		{
+			file: "ping.json",
+			expected: `
+# HELP catchpoint_ping_round_trip_time Average round trip time of the ping packets in milliseconds.
+# TYPE catchpoint_ping_round_trip_time gauge
+catchpoint_ping_round_trip_time{test_id="74"} 12.5
+# HELP catchpoint_ping_packet_loss Percentage of ping packets lost.
+# TYPE catchpoint_ping_packet_loss gauge
+catchpoint_ping_packet_loss{test_id="74"} 20
+# HELP catchpoint_ping_jitter Variation of the round trip time of the ping packets in milliseconds.
+# TYPE catchpoint_ping_jitter gauge
+catchpoint_ping_jitter{test_id="74"} 2.4
+`,
+			metrics: []string{PingRoundTripTimeMetric, PingPacketLossMetric, PingJitterMetric},
+		},
+		{
+			file: "dns.json",
+			expected: `
+# HELP catchpoint_dns_resolution_time Time taken to resolve the queried name in milliseconds.
+# TYPE catchpoint_dns_resolution_time gauge
+catchpoint_dns_resolution_time{test_id="77"} 31
+# HELP catchpoint_dns_response_code DNS response code (RCODE) of the query, 0 meaning no error.
+# TYPE catchpoint_dns_response_code gauge
+catchpoint_dns_response_code{test_id="77"} 3
+# HELP catchpoint_dns_error Indicates if a DNS error occurred during the test.
+# TYPE catchpoint_dns_error gauge
+catchpoint_dns_error{test_id="77"} 0
+`,
+			metrics: []string{DNSResolutionTimeMetric, DNSResponseCodeMetric, DNSErrorMetric},
+		},
+		{
+			file: "traceroute.json",
+			expected: `
+# HELP catchpoint_traceroute_hop_count Number of hops to the destination or the last responding hop.
+# TYPE catchpoint_traceroute_hop_count gauge
+catchpoint_traceroute_hop_count{test_id="73"} 14
+# HELP catchpoint_traceroute_destination_reached Indicates if the traceroute reached the destination.
+# TYPE catchpoint_traceroute_destination_reached gauge
+catchpoint_traceroute_destination_reached{test_id="73"} 1
+`,
+			metrics: []string{TracerouteHopCountMetric, TracerouteDestinationReachedMetric},
+		},
+		{
+			file: "ssl.json",
+			expected: `
+# HELP catchpoint_ssl_certificate_days_to_expiry Number of days until the SSL certificate expires, negative once it expired.
+# TYPE catchpoint_ssl_certificate_days_to_expiry gauge
+catchpoint_ssl_certificate_days_to_expiry{test_id="716"} 27
+# HELP catchpoint_ssl_certificate_valid Indicates if the SSL certificate is valid.
+# TYPE catchpoint_ssl_certificate_valid gauge
+catchpoint_ssl_certificate_valid{test_id="716"} 1
+`,
+			metrics: []string{SSLCertificateDaysToExpiryMetric, SSLCertificateExpiryMetric, SSLCertificateValidMetric},
+		},
+		{
+			file: "api.json",
+			expected: `
+# HELP catchpoint_api_response_code HTTP response code of the API test.
+# TYPE catchpoint_api_response_code gauge
+catchpoint_api_response_code{test_id="79"} 503
+# HELP catchpoint_api_failed_assertions_count Number of assertions of the API test that failed.
+# TYPE catchpoint_api_failed_assertions_count gauge
+catchpoint_api_failed_assertions_count{test_id="79"} 2
+# HELP catchpoint_total_time Total time it took to load the webpage in milliseconds.
+# TYPE catchpoint_total_time gauge
+catchpoint_total_time{test_id="79"} 320
+`,
+			metrics: []string{APIResponseCodeMetric, APIFailedAssertionsCountMetric, TotalTimeMetric},
+		},
+	} {
+		collector, registry := newTestTypeCollector(t, nil)
+		postTestdata(t, collector, tc.file)
+		if err := testutil.GatherAndCompare(registry, strings.NewReader(tc.expected), tc.metrics...); err != nil {
+			t.Errorf("%s: gathered metrics did not match expected metrics: %v", tc.file, err)
+		}
+	}
+}
+
+func TestTestTypeSelection(t *testing.T) {
+	// A web test with a Ping section does not export ping metrics.
+	collector, _ := newTestTypeCollector(t, nil)
+	resp := testResponse("1", "Paris", "100")
+	resp.TestDetails.TypeId = "0"
+	resp.Ping = &PingResult{RoundTripTime: "10"}
+	postWebhook(t, collector, resp)
+	if count := testutil.CollectAndCount(collector, PingRoundTripTimeMetric); count != 0 {
+		t.Errorf("expected no ping metrics for a web test, got %d", count)
+	}
+
+	// The TypeId mapping can be overridden.
+	collector, _ = newTestTypeCollector(t, MergeTestTypes(map[string]string{"0": TestTypePing}))
+	postWebhook(t, collector, resp)
+	if count := testutil.CollectAndCount(collector, PingRoundTripTimeMetric); count != 1 {
+		t.Errorf("expected ping metrics with an overridden test type, got %d", count)
+	}
+}
+
+func TestSSLCertificateExpiry(t *testing.T) {
+	collector, registry := newTestTypeCollector(t, nil)
+	expiry := time.Now().UTC().Add(10*24*time.Hour + time.Hour).Truncate(time.Second)
+	resp := testResponse("1", "Paris", "")
+	resp.TestDetails.TypeId = "16"
+	// The expiry takes precedence over the reported days to expiry.
+	resp.SSL = &SSLResult{CertificateExpiry: expiry.Format("20060102150405"), DaysToExpiry: "99"}
+	postWebhook(t, collector, resp)
+
+	metrics, err := registry.Gather()
+	if err != nil {
+		t.Fatal("gathering metrics failed:", err)
+	}
+	values := make(map[string]float64)
+	for _, mf := range metrics {
+		values[mf.GetName()] = mf.GetMetric()[0].GetGauge().GetValue()
+	}
+	if days := values[SSLCertificateDaysToExpiryMetric]; days <= 10 || days > 10.05 {
+		t.Errorf("expected about 10 days to expiry, got %v", days)
+	}
+	if ts := values[SSLCertificateExpiryMetric]; ts != float64(expiry.Unix()) {
+		t.Errorf("expected the expiry timestamp %d, got %v", expiry.Unix(), ts)
+	}
+}
+
+// TestTemplates checks that the webhook templates only use fields of the
+// model.
+func TestTemplates(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "*template.json"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("expected templates, got %v %v", paths, err)
+	}
+	for _, path := range paths {
+		if filepath.Base(path) == "alert_template.json" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal("failed to read template:", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		var resp Response
+		if err := decoder.Decode(&resp); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+}
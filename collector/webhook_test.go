@@ -0,0 +1,261 @@
+// Copyright 2024 Grafana Labs
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+)
+
+type webhookReply struct {
+	Status string        `json:"status"`
+	Data   WebhookResult `json:"data"`
+	Error  string        `json:"error"`
+}
+
+func decodeWebhookReply(t *testing.T, w *httptest.ResponseRecorder) webhookReply {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a JSON response, got Content-Type %q", ct)
+	}
+	var reply webhookReply
+	if err := json.NewDecoder(w.Body).Decode(&reply); err != nil {
+		t.Fatal("failed to decode webhook response:", err)
+	}
+	return reply
+}
+
+func TestWebhookResponses(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{AllowedClientIDs: []string{""}})
+
+	resp := testResponse("1", "Paris", "100")
+	for _, expected := range []string{OutcomeAccepted, OutcomeDuplicate} {
+		w := postWebhook(t, collector, resp)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		if reply := decodeWebhookReply(t, w); reply.Status != apiStatusSuccess || reply.Data.Outcome != expected {
+			t.Errorf("expected outcome %q, got %+v", expected, reply)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	collector.HandleWebhook(w, httptest.NewRequest("POST", "/webhook", strings.NewReader("{invalid")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid payload, got %d", w.Code)
+	}
+	if reply := decodeWebhookReply(t, w); reply.Error != "invalid webhook payload" {
+		t.Errorf("expected a generic error message, got %q", reply.Error)
+	}
+
+	other := testResponse("1", "Paris", "100")
+	other.TestDetails.ClientId = "456"
+	if w := postWebhook(t, collector, other); w.Code != http.StatusForbidden {
+		t.Errorf("expected status 403 for a disallowed client, got %d", w.Code)
+	}
+
+	collector.Drain()
+	w = postWebhook(t, collector, resp)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected status 503 with Retry-After while draining, got %d %v", w.Code, w.Header())
+	}
+	collector.Resume()
+	if w := postWebhook(t, collector, testResponse("1", "London", "100")); w.Code != http.StatusOK {
+		t.Errorf("expected status 200 after resuming, got %d", w.Code)
+	}
+}
+
+func TestWebhookIdempotencyKey(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{IdempotencyTTL: time.Hour})
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/webhook", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, key)
+		w := httptest.NewRecorder()
+		collector.HandleWebhook(w, req)
+		return w
+	}
+
+	body, _ := json.Marshal(testResponse("1", "Paris", "100"))
+	first := send("abc", string(body))
+	if first.Code != http.StatusOK || first.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Fatalf("expected a fresh 200 response, got %d %v", first.Code, first.Header())
+	}
+
+	// The repeated request gets the original response, not "duplicate".
+	second := send("abc", string(body))
+	if second.Code != http.StatusOK || second.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Fatalf("expected a replayed 200 response, got %d %v", second.Code, second.Header())
+	}
+	if reply := decodeWebhookReply(t, second); reply.Data.Outcome != OutcomeAccepted {
+		t.Errorf("expected the original outcome, got %+v", reply)
+	}
+	if accepted := collector.webhooksAccepted.Load(); accepted != 1 {
+		t.Errorf("expected the repeated request not to be ingested, got %d accepted", accepted)
+	}
+
+	if w := send("abc", "{}"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status 422 for a reused key, got %d", w.Code)
+	}
+	if w := send("def", "{invalid"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+	if w := send("def", "{invalid"); w.Code != http.StatusBadRequest || w.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("expected permanent rejections to be replayed, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestWebhookIdempotencyKeyInProgress(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{IdempotencyTTL: time.Hour})
+
+	body, _ := json.Marshal(testResponse("1", "Paris", "100"))
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, "abc")
+		w := httptest.NewRecorder()
+		collector.HandleWebhook(w, req)
+		return w
+	}
+
+	// Another request with the key is still being processed.
+	if _, ok := collector.idempotency.begin("abc", sha256.Sum256(body), time.Now()); ok {
+		t.Fatal("expected the key to be reserved")
+	}
+	if w := send(); w.Code != http.StatusConflict || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected status 409 with Retry-After, got %d %v", w.Code, w.Header())
+	}
+	if accepted := collector.webhooksAccepted.Load(); accepted != 0 {
+		t.Errorf("expected the concurrent request not to be ingested, got %d accepted", accepted)
+	}
+
+	// A released reservation lets the retry through.
+	collector.idempotency.finish("abc", http.StatusTooManyRequests, apiResponse{}, false, time.Now())
+	if w := send(); w.Code != http.StatusOK || w.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Errorf("expected a fresh 200 response, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestWebhookIdempotencyKeyReplicated(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{IdempotencyTTL: time.Hour, ReplicationSecret: "peer-secret"})
+
+	body, _ := json.Marshal(testResponse("1", "Paris", "100"))
+	backdated := time.Now().Add(-2 * time.Hour).Format(time.RFC3339Nano)
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, "abc")
+		req.Header.Set(ReplicatedByHeader, "instance-1")
+		req.Header.Set(ReplicationSecretHeader, "peer-secret")
+		req.Header.Set(ReceivedAtHeader, backdated)
+		w := httptest.NewRecorder()
+		collector.HandleWebhook(w, req)
+		return w
+	}
+
+	// The key expires an hour after it was received here, not an hour
+	// after the original receive time.
+	send()
+	if w := send(); w.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("expected the replicated key to be remembered, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestWebhookRequestLimits(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{WebhookMaxBodySize: 64})
+
+	w := httptest.NewRecorder()
+	collector.HandleWebhook(w, httptest.NewRequest("GET", "/webhook", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("expected status 405 with Allow header, got %d %v", w.Code, w.Header())
+	}
+
+	req := httptest.NewRequest("POST", "/webhook", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	collector.HandleWebhook(w, req)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status 415 for a form body, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/webhook", strings.NewReader(`{"TestDetails":{"TestName":"`+strings.Repeat("x", 64)+`"}}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	w = httptest.NewRecorder()
+	collector.HandleWebhook(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413 for a large body, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/webhook", strings.NewReader(`{"TestDetails":{"TestId":"1"}}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	w = httptest.NewRecorder()
+	collector.HandleWebhook(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200 for a small JSON body, got %d", w.Code)
+	}
+}
+
+func TestWebhookRateLimit(t *testing.T) {
+	logger := promlog.New(&promlog.Config{})
+	collector := NewCollector(logger, &Config{WebhookRateLimit: 0.001, WebhookRateBurst: 2})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal("failed to register collector:", err)
+	}
+
+	send := func(remoteAddr string) int {
+		body, _ := json.Marshal(testResponse("1", "Paris", "100"))
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		collector.HandleWebhook(w, req)
+		return w.Code
+	}
+
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if code := send("192.0.2.1:1234"); code != expected {
+			t.Errorf("request %d: expected status %d, got %d", i, expected, code)
+		}
+	}
+	// Every source IP has its own budget, regardless of the port.
+	if code := send("192.0.2.2:1234"); code != http.StatusOK {
+		t.Errorf("expected another source to be allowed, got %d", code)
+	}
+	if code := send("192.0.2.1:5678"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the throttled source to stay throttled, got %d", code)
+	}
+
+	expected := `
+# HELP catchpoint_webhook_throttled_total Number of webhooks rejected with 429 because their source exceeded the rate limit.
+# TYPE catchpoint_webhook_throttled_total counter
+catchpoint_webhook_throttled_total 2
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), WebhookThrottledMetric); err != nil {
+		t.Errorf("gathered metrics did not match expected metrics: %v", err)
+	}
+}
@@ -5,8 +5,10 @@ go 1.20
 require (
 	github.com/alecthomas/kingpin/v2 v2.4.0
 	github.com/go-kit/log v0.2.1
+	github.com/klauspost/compress v1.17.4
 	github.com/prometheus/client_golang v1.19.0
 	github.com/prometheus/common v0.48.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (